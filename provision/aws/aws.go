@@ -12,8 +12,8 @@ import (
 
 	"strings"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
 	garbler "github.com/michaelbironneau/garbler/lib"
+	"github.com/sashajeltuhin/ket/provision/plan"
 	"github.com/spf13/cobra"
 )
 
@@ -2,6 +2,7 @@ package aws
 
 import (
 	"bufio"
+	"encoding/base64"
 	"fmt"
 	"os"
 
@@ -70,8 +71,9 @@ func (c *Client) getAPIClient() (*ec2.EC2, error) {
 }
 
 // CreateNode is for creating a machine on AWS using the given AMI and InstanceType.
+// The machine runs the given cloud-init user data on first boot.
 // Returns the ID of the newly created machine.
-func (c Client) CreateNode(ami AMI, instanceType InstanceType, size int64) (string, error) {
+func (c Client) CreateNode(ami AMI, instanceType InstanceType, size int64, userData []byte) (string, error) {
 	api, err := c.getAPIClient()
 	if err != nil {
 		return "", err
@@ -91,6 +93,7 @@ func (c Client) CreateNode(ami AMI, instanceType InstanceType, size int64) (stri
 		MinCount:     aws.Int64(1),
 		MaxCount:     aws.Int64(1),
 		KeyName:      aws.String(c.Config.Keyname),
+		UserData:     aws.String(base64.StdEncoding.EncodeToString(userData)),
 		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{
 			&ec2.InstanceNetworkInterfaceSpecification{
 				AssociatePublicIpAddress: aws.Bool(true),
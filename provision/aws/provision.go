@@ -7,7 +7,9 @@ import (
 	"regexp"
 	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/cloudinit"
+	"github.com/sashajeltuhin/ket/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/utils"
 )
 
 const (
@@ -179,24 +181,28 @@ func (p awsProvisioner) ProvisionNodes(blueprint NodeBlueprint, nodeCount NodeCo
 	default:
 		panic(fmt.Sprintf("Used an unsupported distribution: %s", distro))
 	}
+	userData, err := p.userData()
+	if err != nil {
+		return ProvisionedNodes{}, err
+	}
 	provisioned := ProvisionedNodes{}
 	var i uint16
 	for i = 0; i < nodeCount.Etcd; i++ {
-		nodeID, err := p.client.CreateNode(ami, blueprint.EtcdInstanceType, blueprint.EtcdDisk)
+		nodeID, err := p.client.CreateNode(ami, blueprint.EtcdInstanceType, blueprint.EtcdDisk, userData)
 		if err != nil {
 			return provisioned, err
 		}
 		provisioned.Etcd = append(provisioned.Etcd, plan.Node{ID: nodeID})
 	}
 	for i = 0; i < nodeCount.Master; i++ {
-		nodeID, err := p.client.CreateNode(ami, blueprint.MasterInstanceType, blueprint.MasterDisk)
+		nodeID, err := p.client.CreateNode(ami, blueprint.MasterInstanceType, blueprint.MasterDisk, userData)
 		if err != nil {
 			return provisioned, err
 		}
 		provisioned.Master = append(provisioned.Master, plan.Node{ID: nodeID})
 	}
 	for i = 0; i < nodeCount.Worker; i++ {
-		nodeID, err := p.client.CreateNode(ami, blueprint.WorkerInstanceType, blueprint.WorkerDisk)
+		nodeID, err := p.client.CreateNode(ami, blueprint.WorkerInstanceType, blueprint.WorkerDisk, userData)
 		if err != nil {
 			return provisioned, err
 		}
@@ -225,6 +231,16 @@ func (p awsProvisioner) ProvisionNodes(blueprint NodeBlueprint, nodeCount NodeCo
 	return provisioned, nil
 }
 
+// userData returns the cloud-init user data of the nodes, which authorizes the keypair for the kismatic user.
+// AWS names the nodes, so their hostnames are left alone.
+func (p awsProvisioner) userData() ([]byte, error) {
+	publicKey, err := utils.LoadPublicSSHKey(p.sshKey)
+	if err != nil {
+		return nil, fmt.Errorf("error reading SSH key %q: %v", p.sshKey, err)
+	}
+	return cloudinit.UserData(cloudinit.ForNode(cloudinit.Node{SSHAuthorizedKeys: []string{publicKey}}))
+}
+
 func (p awsProvisioner) updateNodeWithDeets(nodeID string, node *plan.Node) error {
 	for {
 		fmt.Print(".")
@@ -7,7 +7,7 @@ import (
 	"os/exec"
 	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/plan"
 )
 
 func runViaSSH(cmds []string, hosts []plan.Node, sshKey string, period time.Duration) error {
@@ -0,0 +1,145 @@
+// Package cloudinit generates the cloud-init user data that prepares the nodes created by the providers
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Header is the first line of every cloud-config document
+const Header = "#cloud-config"
+
+// Config is a cloud-config document
+type Config struct {
+	Hostname string
+	FQDN     string
+	// KeepDefaultUser keeps the default user of the image, which the providers SSH in as
+	KeepDefaultUser bool
+	Users           []User
+	PackageUpdate   bool
+	Packages        []string
+	Files           []File
+	DNS             *DNS
+	RunCmd          []string
+	PhoneHome       *PhoneHome
+}
+
+// User is a user created on the node
+type User struct {
+	Name              string   `yaml:"name"`
+	Groups            []string `yaml:"groups,omitempty,flow"`
+	Shell             string   `yaml:"shell,omitempty"`
+	Sudo              string   `yaml:"sudo,omitempty"`
+	LockPassword      bool     `yaml:"lock_passwd"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+}
+
+// File is written to the node before the packages are installed
+type File struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Owner       string `yaml:"owner,omitempty"`
+}
+
+// DNS configures the resolver of the node
+type DNS struct {
+	Nameservers   []string `yaml:"nameservers,omitempty,flow"`
+	SearchDomains []string `yaml:"searchdomains,omitempty,flow"`
+	Domain        string   `yaml:"domain,omitempty"`
+}
+
+// PhoneHome is where the node reports to once it has finished booting.
+// The URL may contain $INSTANCE_ID, which is replaced with the ID of the node.
+type PhoneHome struct {
+	URL   string   `yaml:"url"`
+	Post  []string `yaml:"post,omitempty,flow"`
+	Tries int      `yaml:"tries,omitempty"`
+}
+
+// document is the cloud-config representation of the Config
+type document struct {
+	Hostname         string        `yaml:"hostname,omitempty"`
+	FQDN             string        `yaml:"fqdn,omitempty"`
+	ManageEtcHosts   bool          `yaml:"manage_etc_hosts,omitempty"`
+	Users            []interface{} `yaml:"users,omitempty"`
+	PackageUpdate    bool          `yaml:"package_update,omitempty"`
+	Packages         []string      `yaml:"packages,omitempty"`
+	WriteFiles       []File        `yaml:"write_files,omitempty"`
+	ManageResolvConf bool          `yaml:"manage_resolv_conf,omitempty"`
+	ResolvConf       *DNS          `yaml:"resolv_conf,omitempty"`
+	RunCmd           []string      `yaml:"runcmd,omitempty"`
+	PhoneHome        *PhoneHome    `yaml:"phone_home,omitempty"`
+}
+
+// Render returns the cloud-config document
+func (c Config) Render() ([]byte, error) {
+	doc := document{
+		Hostname:         c.Hostname,
+		FQDN:             c.FQDN,
+		ManageEtcHosts:   c.Hostname != "",
+		PackageUpdate:    c.PackageUpdate,
+		Packages:         c.Packages,
+		WriteFiles:       c.Files,
+		ManageResolvConf: c.DNS != nil,
+		ResolvConf:       c.DNS,
+		RunCmd:           c.RunCmd,
+		PhoneHome:        c.PhoneHome,
+	}
+	if c.KeepDefaultUser {
+		doc.Users = append(doc.Users, "default")
+	}
+	for _, u := range c.Users {
+		doc.Users = append(doc.Users, u)
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering cloud-config: %v", err)
+	}
+	return append([]byte(Header+"\n"), data...), nil
+}
+
+// UserData returns the user data that applies the configuration, and then runs the scripts.
+// Scripts are combined with the configuration in a MIME multi-part archive.
+func UserData(c Config, scripts ...string) ([]byte, error) {
+	config, err := c.Render()
+	if err != nil {
+		return nil, err
+	}
+	if len(scripts) == 0 {
+		return config, nil
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := writePart(w, "text/cloud-config", config); err != nil {
+		return nil, err
+	}
+	for _, s := range scripts {
+		if err := writePart(w, "text/x-shellscript", []byte(s)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	var archive bytes.Buffer
+	fmt.Fprintf(&archive, "Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", w.Boundary())
+	archive.Write(body.Bytes())
+	return archive.Bytes(), nil
+}
+
+func writePart(w *multipart.Writer, contentType string, content []byte) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", contentType+`; charset="utf-8"`)
+	h.Set("MIME-Version", "1.0")
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(content)
+	return err
+}
@@ -0,0 +1,61 @@
+package cloudinit
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRenderForNode(t *testing.T) {
+	c := ForNode(Node{Hostname: "kismatic-worker-0", Domain: "example.local", SSHAuthorizedKeys: []string{"ssh-rsa AAAA"}, Nameservers: []string{"10.0.0.2"}})
+	data, err := c.Render()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(data), Header+"\n") {
+		t.Errorf("document does not start with %q:\n%s", Header, data)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("document is not valid YAML: %v", err)
+	}
+	if doc["fqdn"] != "kismatic-worker-0.example.local" {
+		t.Errorf("expected fqdn to be set, got %v", doc["fqdn"])
+	}
+	users, ok := doc["users"].([]interface{})
+	if !ok || len(users) != 2 {
+		t.Fatalf("expected the default and the kismatic user, got %v", doc["users"])
+	}
+	if users[0] != "default" {
+		t.Errorf("expected the default user first, got %v", users[0])
+	}
+	if !strings.Contains(string(data), "ssh-rsa AAAA") {
+		t.Errorf("authorized key missing from document:\n%s", data)
+	}
+	if doc["manage_resolv_conf"] != true {
+		t.Errorf("expected resolv.conf to be managed when nameservers are set")
+	}
+}
+
+func TestUserDataWithScripts(t *testing.T) {
+	data, err := UserData(Config{Hostname: "node"}, "#!/bin/bash\necho hello\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := string(data)
+	if !strings.HasPrefix(s, "Content-Type: multipart/mixed") {
+		t.Errorf("expected a multi-part archive, got:\n%s", s)
+	}
+	if !strings.Contains(s, "text/cloud-config") || !strings.Contains(s, "text/x-shellscript") {
+		t.Errorf("expected a cloud-config and a shell script part, got:\n%s", s)
+	}
+
+	data, err = UserData(Config{Hostname: "node"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(data), Header) {
+		t.Errorf("expected a plain cloud-config document without scripts, got:\n%s", data)
+	}
+}
@@ -0,0 +1,70 @@
+package cloudinit
+
+import "strings"
+
+// KismaticUser is the user created on every node for the kismatic installer
+const KismaticUser = "kismaticuser"
+
+// nodePackages are the prerequisites of docker and kubernetes, with the same name on every supported distro
+var nodePackages = []string{"curl", "ca-certificates", "lvm2", "socat", "ebtables", "ethtool"}
+
+// Node describes a node to be prepared for a cluster
+type Node struct {
+	// Hostname of the node. The provider's hostname is kept if empty.
+	Hostname string
+	// Domain of the node, used for its FQDN and as the DNS search domain
+	Domain string
+	// SSHAuthorizedKeys can be used to SSH into the node as the kismatic user
+	SSHAuthorizedKeys []string
+	// Nameservers replace the resolvers of the node, if any
+	Nameservers []string
+	// PhoneHomeURL is called once the node is prepared, if set
+	PhoneHomeURL string
+}
+
+// ForNode returns the configuration that prepares a node for a cluster the same way on every provider.
+// The kismatic user is created with passwordless sudo, and the prerequisites of docker are installed.
+func ForNode(n Node) Config {
+	c := Config{
+		Hostname:        n.Hostname,
+		KeepDefaultUser: true,
+		Users: []User{
+			{
+				Name:              KismaticUser,
+				Shell:             "/bin/bash",
+				Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+				LockPassword:      true,
+				SSHAuthorizedKeys: n.SSHAuthorizedKeys,
+			},
+		},
+		PackageUpdate: true,
+		Packages:      nodePackages,
+		Files: []File{
+			{
+				Path:        "/etc/modules-load.d/kismatic.conf",
+				Content:     "br_netfilter\n",
+				Permissions: "0644",
+			},
+			{
+				Path:        "/etc/sysctl.d/99-kismatic.conf",
+				Content:     "net.bridge.bridge-nf-call-iptables = 1\nnet.ipv4.ip_forward = 1\n",
+				Permissions: "0644",
+			},
+		},
+		RunCmd: []string{"modprobe br_netfilter", "sysctl --system"},
+	}
+	if n.Hostname != "" && n.Domain != "" {
+		c.FQDN = n.Hostname + "." + strings.TrimPrefix(n.Domain, ".")
+	}
+	if len(n.Nameservers) > 0 {
+		c.DNS = &DNS{Nameservers: n.Nameservers}
+		if n.Domain != "" {
+			c.DNS.Domain = n.Domain
+			c.DNS.SearchDomains = []string{n.Domain}
+		}
+	}
+	if n.PhoneHomeURL != "" {
+		c.PhoneHome = &PhoneHome{URL: n.PhoneHomeURL, Post: []string{"instance_id", "hostname", "fqdn"}, Tries: 10}
+	}
+	return c
+}
@@ -0,0 +1,17 @@
+module github.com/sashajeltuhin/ket
+
+go 1.18
+
+require (
+	github.com/Jeffail/gabs v1.1.1
+	github.com/howeyc/gopass v0.0.0-20210920133722-c8aef6fb66ef
+	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/term v0.15.0 // indirect
+)
@@ -1,19 +1,76 @@
 package main
 
 import (
+	"crypto/tls"
+	"flag"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/sashajeltuhin/ket/provision/openstack"
 )
 
 func main() {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/nodeup", openstack.NodeUp)
-	mux.HandleFunc("/install", openstack.ProvisionAndInstall)
-	log.Println("Listening on port 8013")
-	err := http.ListenAndServe(":8013", mux)
+	addr := flag.String("addr", ":8013", "Address to listen on")
+	tlsCert := flag.String("tls-cert", envOrDefault("PROVISION_WEB_TLS_CERT", "/ket/tls/orchestrator.crt"), "Server certificate. A self-signed certificate is generated if it does not exist")
+	tlsKey := flag.String("tls-key", envOrDefault("PROVISION_WEB_TLS_KEY", "/ket/tls/orchestrator.key"), "Private key of the server certificate")
+	certIPs := flag.String("cert-ips", os.Getenv("PROVISION_WEB_CERT_IPS"), "Comma separated IPs the nodes reach the orchestrator on, for the generated certificate")
+	stateDir := flag.String("state-dir", os.Getenv("PROVISION_WEB_STATE_DIR"), "Directory the cluster and its registered nodes are persisted to, so that they survive restarts. Kept in memory only when empty")
+	flag.Parse()
+
+	// The token is only read from the environment, so that it does not show in the process list
+	token := os.Getenv("PROVISION_WEB_BOOTSTRAP_TOKEN")
+	if token == "" {
+		log.Fatal("Refusing to start without authentication. Set PROVISION_WEB_BOOTSTRAP_TOKEN")
+	}
+	ips := []net.IP{}
+	for _, s := range strings.Split(*certIPs, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			log.Fatalf("Invalid IP %q in --cert-ips", s)
+		}
+		ips = append(ips, ip)
+	}
+	cert, fingerprint, err := openstack.LoadOrCreateCertificate(*tlsCert, *tlsKey, ips)
 	if err != nil {
+		log.Fatal(err)
+	}
+	certPEM, err := ioutil.ReadFile(*tlsCert)
+	if err != nil {
+		log.Fatal("Error reading the certificate: ", err)
+	}
+
+	orchestrator := openstack.NewOrchestrator(token)
+	orchestrator.Certificate = string(certPEM)
+	orchestrator.StateDir = *stateDir
+	if err := orchestrator.Restore(); err != nil {
+		log.Fatal("Error restoring the cluster: ", err)
+	}
+	server := &http.Server{
+		Addr:           *addr,
+		Handler:        orchestrator.Handler(),
+		ReadTimeout:    30 * time.Second,
+		MaxHeaderBytes: 64 << 10,
+		TLSConfig:      &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	log.Println("Certificate fingerprint", fingerprint)
+	log.Println("Listening on", *addr)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
 }
+
+func envOrDefault(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,284 @@
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Auth holds the Keystone v3 credentials and scope used to authenticate with Openstack.
+// Either a user name and password, or an application credential must be provided.
+type Auth struct {
+	AuthURL                     string `json:"auth_url"`
+	Username                    string `json:"username,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	UserDomainName              string `json:"user_domain_name,omitempty"`
+	ProjectID                   string `json:"project_id,omitempty"`
+	ProjectName                 string `json:"project_name,omitempty"`
+	ProjectDomainName           string `json:"project_domain_name,omitempty"`
+	ApplicationCredentialID     string `json:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+}
+
+// Keystone v3 token request structures
+type tokenRequest struct {
+	Auth struct {
+		Identity identity `json:"identity"`
+		Scope    *scope   `json:"scope,omitempty"`
+	} `json:"auth"`
+}
+
+type identity struct {
+	Methods               []string               `json:"methods"`
+	Password              *passwordMethod        `json:"password,omitempty"`
+	ApplicationCredential *applicationCredential `json:"application_credential,omitempty"`
+}
+
+type passwordMethod struct {
+	User struct {
+		Name     string  `json:"name"`
+		Domain   *domain `json:"domain,omitempty"`
+		Password string  `json:"password"`
+	} `json:"user"`
+}
+
+type applicationCredential struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+type scope struct {
+	Project struct {
+		ID     string  `json:"id,omitempty"`
+		Name   string  `json:"name,omitempty"`
+		Domain *domain `json:"domain,omitempty"`
+	} `json:"project"`
+}
+
+type domain struct {
+	Name string `json:"name"`
+}
+
+func (a Auth) usesApplicationCredential() bool {
+	return a.ApplicationCredentialID != ""
+}
+
+// missing returns the credentials that are required but were not provided
+func (a Auth) missing() []string {
+	missing := []string{}
+	if a.AuthURL == "" {
+		missing = append(missing, "auth URL (--os-auth-url, --os-url or OS_AUTH_URL)")
+	}
+	if a.usesApplicationCredential() {
+		if a.ApplicationCredentialSecret == "" {
+			missing = append(missing, "application credential secret (--os-app-cred-secret or OS_APPLICATION_CREDENTIAL_SECRET)")
+		}
+		return missing
+	}
+	if a.Username == "" {
+		missing = append(missing, "user name (--os-user or OS_USERNAME)")
+	}
+	if a.Password == "" {
+		missing = append(missing, "password (--os-pass or OS_PASSWORD)")
+	}
+	if a.ProjectID == "" && a.ProjectName == "" {
+		missing = append(missing, "project ID or name (--os-tenant, --os-project-name, OS_PROJECT_ID or OS_PROJECT_NAME)")
+	}
+	return missing
+}
+
+// validate returns an error listing the missing credentials
+func (a Auth) validate() error {
+	if missing := a.missing(); len(missing) > 0 {
+		return fmt.Errorf("missing Openstack credentials: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// tokenRequest builds the body of the Keystone v3 token request.
+// Application credentials are always scoped to the project they were created in.
+func (a Auth) tokenRequest() tokenRequest {
+	var req tokenRequest
+	if a.usesApplicationCredential() {
+		req.Auth.Identity.Methods = []string{"application_credential"}
+		req.Auth.Identity.ApplicationCredential = &applicationCredential{ID: a.ApplicationCredentialID, Secret: a.ApplicationCredentialSecret}
+		return req
+	}
+	pw := &passwordMethod{}
+	pw.User.Name = a.Username
+	pw.User.Password = a.Password
+	pw.User.Domain = &domain{Name: defaultDomain(a.UserDomainName)}
+	req.Auth.Identity.Methods = []string{"password"}
+	req.Auth.Identity.Password = pw
+
+	s := &scope{}
+	if a.ProjectID != "" {
+		s.Project.ID = a.ProjectID
+	} else {
+		s.Project.Name = a.ProjectName
+		s.Project.Domain = &domain{Name: defaultDomain(a.ProjectDomainName)}
+	}
+	req.Auth.Scope = s
+	return req
+}
+
+func defaultDomain(name string) string {
+	if name == "" {
+		return "Default"
+	}
+	return name
+}
+
+// tokensURL returns the URL used to request tokens. The auth URL may or may not include the API version.
+func (a Auth) tokensURL() string {
+	u := strings.TrimRight(a.AuthURL, "/")
+	if !strings.HasSuffix(u, "/v3") {
+		u = u + "/v3"
+	}
+	return u + "/auth/tokens"
+}
+
+// cloudsYAML is the subset of the clouds.yaml format that we understand
+type cloudsYAML struct {
+	Clouds map[string]struct {
+		Auth struct {
+			AuthURL                     string `yaml:"auth_url"`
+			Username                    string `yaml:"username"`
+			Password                    string `yaml:"password"`
+			UserDomainName              string `yaml:"user_domain_name"`
+			ProjectID                   string `yaml:"project_id"`
+			ProjectName                 string `yaml:"project_name"`
+			ProjectDomainName           string `yaml:"project_domain_name"`
+			ApplicationCredentialID     string `yaml:"application_credential_id"`
+			ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+		} `yaml:"auth"`
+		RegionName string `yaml:"region_name"`
+		Interface  string `yaml:"interface"`
+		CACert     string `yaml:"cacert"`
+		Verify     *bool  `yaml:"verify"`
+	} `yaml:"clouds"`
+}
+
+// cloudsYAMLPaths returns the locations searched for clouds.yaml, in order of preference
+func cloudsYAMLPaths() []string {
+	paths := []string{"clouds.yaml"}
+	if home := os.Getenv("HOME"); home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "openstack", "clouds.yaml"))
+	}
+	return append(paths, "/etc/openstack/clouds.yaml")
+}
+
+// cloudFromCloudsYAML returns the credentials and endpoint selection of the named cloud in the first clouds.yaml found
+func cloudFromCloudsYAML(cloud string) (Auth, Config, error) {
+	for _, p := range cloudsYAMLPaths() {
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Auth{}, Config{}, err
+		}
+		var clouds cloudsYAML
+		if err := yaml.Unmarshal(data, &clouds); err != nil {
+			return Auth{}, Config{}, fmt.Errorf("error parsing %s: %v", p, err)
+		}
+		c, ok := clouds.Clouds[cloud]
+		if !ok {
+			return Auth{}, Config{}, fmt.Errorf("cloud %q not found in %s", cloud, p)
+		}
+		a := Auth{
+			AuthURL:                     c.Auth.AuthURL,
+			Username:                    c.Auth.Username,
+			Password:                    c.Auth.Password,
+			UserDomainName:              c.Auth.UserDomainName,
+			ProjectID:                   c.Auth.ProjectID,
+			ProjectName:                 c.Auth.ProjectName,
+			ProjectDomainName:           c.Auth.ProjectDomainName,
+			ApplicationCredentialID:     c.Auth.ApplicationCredentialID,
+			ApplicationCredentialSecret: c.Auth.ApplicationCredentialSecret,
+		}
+		conf := Config{Region: c.RegionName, Interface: c.Interface, CACertFile: c.CACert}
+		if c.Verify != nil {
+			conf.Insecure = !*c.Verify
+		}
+		return a, conf, nil
+	}
+	return Auth{}, Config{}, errors.New("clouds.yaml not found")
+}
+
+// resolveCloud applies the configuration layers to the flags, and builds the credentials and endpoint
+// selection from them. The cloud in clouds.yaml selected with --os-cloud provides the values that are
+// not set by any flag, environment variable or profile.
+func resolveCloud(flags *pflag.FlagSet, opts *KetOpts) (Auth, Config, error) {
+	if err := applyConfigLayers(flags, opts.Profile); err != nil {
+		return Auth{}, Config{}, err
+	}
+	a := Auth{}
+	conf := Config{}
+	if opts.OSCloud != "" {
+		var err error
+		if a, conf, err = cloudFromCloudsYAML(opts.OSCloud); err != nil {
+			return a, conf, err
+		}
+	}
+
+	settings := []struct {
+		field *string
+		value string
+	}{
+		{&a.AuthURL, opts.OSAuthURL},
+		{&a.Username, opts.OSUser},
+		{&a.Password, opts.OSUserPass},
+		{&a.UserDomainName, opts.OSUserDomain},
+		{&a.ProjectID, opts.OSTenant},
+		{&a.ProjectName, opts.OSProjectName},
+		{&a.ProjectDomainName, opts.OSProjectDomain},
+		{&a.ApplicationCredentialID, opts.OSAppCredID},
+		{&a.ApplicationCredentialSecret, opts.OSAppCredSecret},
+		{&conf.Region, opts.OSRegion},
+		{&conf.Interface, opts.OSInterface},
+		{&conf.CACertFile, opts.OSCACert},
+	}
+	for _, s := range settings {
+		if s.value != "" {
+			*s.field = s.value
+		}
+	}
+
+	if flags.Changed("insecure") {
+		conf.Insecure = opts.Insecure
+	}
+	if conf.CACertFile != "" {
+		pem, err := ioutil.ReadFile(conf.CACertFile)
+		if err != nil {
+			return a, conf, fmt.Errorf("error reading CA bundle: %v", err)
+		}
+		conf.CACert = string(pem)
+	}
+
+	// Derive the auth URL from the Openstack URL when it was not provided
+	if a.AuthURL == "" && opts.OSUrl != "" {
+		a.AuthURL = fmt.Sprintf("%s:%s/v3", opts.OSUrl, KeystonePort)
+	}
+	return a, conf, nil
+}
+
+// tokenResponse is the subset of the Keystone v3 token response body that we use.
+// The token itself is returned in the X-Subject-Token header.
+type tokenResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Project   struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"project"`
+		Catalog []catalogEntry `json:"catalog"`
+	} `json:"token"`
+}
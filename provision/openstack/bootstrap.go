@@ -0,0 +1,82 @@
+package openstack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+// bootstrapData is the data the bootstrap script templates are rendered with
+type bootstrapData struct {
+	Version      string
+	NodeName     string
+	NodeType     string
+	DNSIP        string
+	Domain       string
+	DomainSuffix string
+	WebIP        string
+	WebPort      string
+	WebCert      string
+	AuthToken    string
+	// OrchestratorVersion is the revision of ket the installer builds the orchestrator from
+	OrchestratorVersion string
+}
+
+// bootstrapScript returns the bootstrap script template of the node type, and its version.
+// Templates that override the embedded ones are versioned by a hash of their content.
+func bootstrapScript(conf Config, nodeType string) (string, string) {
+	key, embedded := "node", NodeScript
+	if nodeType == "install" {
+		key, embedded = "install", InstallScript
+	}
+	if custom := conf.Scripts[key]; custom != "" {
+		sum := sha256.Sum256([]byte(custom))
+		return custom, "custom-" + hex.EncodeToString(sum[:6])
+	}
+	return embedded, BootstrapScriptVersion
+}
+
+// renderBootstrapScript renders the script template. Values are shell quoted with the quote function.
+func renderBootstrapScript(script string, data bootstrapData) (string, error) {
+	tmpl, err := template.New("bootstrap").Funcs(template.FuncMap{"quote": shellQuote}).Parse(script)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing bootstrap script: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Error rendering bootstrap script: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// shellQuote quotes the value so that the shell reads it as a single word, without expansions
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'"'"'`, -1) + "'"
+}
+
+// loadBootstrapScripts reads the script templates that override the embedded ones. Their content is
+// kept in the config, as the orchestrator on the installer node renders the scripts of the cluster nodes.
+func loadBootstrapScripts(conf *Config, opts KetOpts) error {
+	paths := map[string]string{"install": opts.InstallScript, "node": opts.NodeScript}
+	for key, path := range paths {
+		if path == "" {
+			continue
+		}
+		script, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading bootstrap script: %v", err)
+		}
+		if _, err := renderBootstrapScript(string(script), bootstrapData{}); err != nil {
+			return fmt.Errorf("Invalid bootstrap script %s: %v", path, err)
+		}
+		if conf.Scripts == nil {
+			conf.Scripts = map[string]string{}
+		}
+		conf.Scripts[key] = string(script)
+	}
+	return nil
+}
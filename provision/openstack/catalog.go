@@ -0,0 +1,81 @@
+package openstack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Service types in the Keystone service catalog
+const (
+	computeService = "compute"
+	networkService = "network"
+	imageService   = "image"
+)
+
+// catalogEntry is a service in the Keystone service catalog
+type catalogEntry struct {
+	Type      string     `json:"type"`
+	Name      string     `json:"name"`
+	Endpoints []endpoint `json:"endpoints"`
+}
+
+// endpoint is where a service can be reached, from a given interface and region
+type endpoint struct {
+	Interface string `json:"interface"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	URL       string `json:"url"`
+}
+
+// endpoint returns the URL of the service of the given type from the service catalog, for the
+// interface and region in the config. The public interface is used when none is configured.
+func (c *Client) endpoint(serviceType string, conf Config) (string, error) {
+	iface := conf.Interface
+	if iface == "" {
+		iface = "public"
+	}
+	for _, svc := range c.Catalog {
+		if svc.Type != serviceType {
+			continue
+		}
+		for _, e := range svc.Endpoints {
+			if e.Interface != iface {
+				continue
+			}
+			if conf.Region != "" && e.Region != conf.Region && e.RegionID != conf.Region {
+				continue
+			}
+			return strings.TrimRight(e.URL, "/"), nil
+		}
+	}
+	if conf.Region != "" {
+		return "", fmt.Errorf("No %s endpoint found for interface %q in region %q", serviceType, iface, conf.Region)
+	}
+	return "", fmt.Errorf("No %s endpoint found for interface %q", serviceType, iface)
+}
+
+// computeURL returns the Nova endpoint, which includes the API version and usually the project ID
+func (c *Client) computeURL(conf Config) (string, error) {
+	return c.endpoint(computeService, conf)
+}
+
+// networkURL returns the versioned Neutron endpoint. Neutron endpoints are usually published without the version.
+func (c *Client) networkURL(conf Config) (string, error) {
+	return c.versionedEndpoint(networkService, "v2.0", conf)
+}
+
+// imageURL returns the versioned Glance endpoint. Glance endpoints are usually published without the version.
+func (c *Client) imageURL(conf Config) (string, error) {
+	return c.versionedEndpoint(imageService, "v2", conf)
+}
+
+func (c *Client) versionedEndpoint(serviceType string, version string, conf Config) (string, error) {
+	url, err := c.endpoint(serviceType, conf)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(url, "/"+version) {
+		url = url + "/" + version
+	}
+	return url, nil
+}
@@ -1,12 +1,9 @@
 package openstack
 
 import (
-	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	s "strings"
@@ -15,55 +12,74 @@ import (
 	"github.com/Jeffail/gabs"
 )
 
-const (
-	KeystonePort = "5000"
-	ComputePort  = "8774"
-	NetworkPort  = "9696"
-)
+// KeystonePort is where Keystone listens when only the Openstack URL is provided.
+// All other endpoints are discovered from the service catalog.
+const KeystonePort = "5000"
 
+// Config selects the endpoints to use from the service catalog, and how to connect to them
 type Config struct {
-	Urlauth          string
-	Apiverauth       string
-	Apivernet        string
-	Urlcomp          string
-	Urlnet           string
-	Apivercomp       string
-	InstallscriptURL string
-}
-
-// Credentials to be used for accessing the AI
-type Credentials struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-// Openstack auth structure
-type Auth struct {
-	Body struct {
-		Credentials Credentials `json:"passwordCredentials"`
-		Tenant      string      `json:"tenantId"`
-	} `json:"auth"`
+	Region    string
+	Interface string
+	// CACertFile is the path of the CA bundle used to verify the Openstack certificates instead of the system roots
+	CACertFile string `json:"-"`
+	// CACert is the PEM encoded content of CACertFile. It is only kept in memory, and is not sent to the installer.
+	CACert   string `json:"-"`
+	Insecure bool
+	// Scripts are bootstrap script templates that override the embedded ones, keyed by "install" or "node"
+	Scripts map[string]string `json:",omitempty"`
 }
 
 // Client for provisioning machines on Openstack
 type Client struct {
-	Token   string    `json:"token"`
-	Expires time.Time `json:"expires"`
+	Token     string         `json:"token"`
+	Expires   time.Time      `json:"expires"`
+	ProjectID string         `json:"project_id"`
+	Catalog   []catalogEntry `json:"catalog"`
+	http      *http.Client
 }
 
-//Openstack server info structure
+// Openstack server info structure
 type serverData struct {
 	Server struct {
-		Name            string     `json:"name"`
-		User_data       string     `json:"user_data"`
-		Key_name        string     `json:"key_name,omitempty"`
-		ImageRef        string     `json:"imageRef"`
-		FlavorRef       string     `json:"flavorRef"`
-		Networks        []network  `json:"networks"`
-		Security_groups []secgroup `json:"security_groups"`
+		Name            string            `json:"name"`
+		User_data       string            `json:"user_data"`
+		Key_name        string            `json:"key_name,omitempty"`
+		ImageRef        string            `json:"imageRef"`
+		FlavorRef       string            `json:"flavorRef"`
+		Networks        []network         `json:"networks"`
+		Security_groups []secgroup        `json:"security_groups"`
+		Metadata        map[string]string `json:"metadata,omitempty"`
 	} `json:"server"`
 }
 
+// server is a Nova server as returned by the servers/detail API
+type server struct {
+	ID        string                     `json:"id"`
+	Name      string                     `json:"name"`
+	Status    string                     `json:"status"`
+	Metadata  map[string]string          `json:"metadata"`
+	Addresses map[string][]serverAddress `json:"addresses"`
+}
+
+type serverAddress struct {
+	Addr string `json:"addr"`
+	Type string `json:"OS-EXT-IPS:type"`
+}
+
+// addresses returns the fixed and floating IPs of the server
+func (srv server) addresses() (fixed []string, floating []string) {
+	for _, addrs := range srv.Addresses {
+		for _, a := range addrs {
+			if a.Type == "floating" {
+				floating = append(floating, a.Addr)
+			} else {
+				fixed = append(fixed, a.Addr)
+			}
+		}
+	}
+	return fixed, floating
+}
+
 type network struct {
 	Uuid string `json:"uuid"`
 }
@@ -78,75 +94,68 @@ type floatingIPAction struct {
 	} `json:"addFloatingIp"`
 }
 
+type removeFloatingIPAction struct {
+	RemoveFloatingIp struct {
+		Address string `json:"address"`
+	} `json:"removeFloatingIp"`
+}
+
 func isValidJSON(s string) bool {
 	var js map[string]interface{}
 	return json.Unmarshal([]byte(s), &js) == nil
 }
 
+// login authenticates with Keystone v3 and returns a token scoped to the project in the credentials.
+// The token is cached per user until shortly before it expires.
 func (c *Client) login(a Auth, conf Config) (string, error) {
-	var fileName = a.Body.Credentials.Username + ".token"
-	dat, readerr := ioutil.ReadFile(fileName)
-	if readerr == nil && dat != nil && len(dat) > 0 {
-		var savedCreds Client
-		deserr := json.Unmarshal(dat, &savedCreds)
-		if deserr == nil {
-			now := time.Now()
-			exptime := savedCreds.Expires
-			if now.Before(exptime) {
-				c.Token = savedCreds.Token
-				return c.Token, nil
-			}
-		}
+	if c.Token != "" && tokenValid(c.Expires) {
+		return c.Token, nil
+	}
+	if savedCreds, ok := loadCachedToken(a); ok {
+		c.Token, c.Expires, c.ProjectID, c.Catalog = savedCreds.Token, savedCreds.Expires, savedCreds.ProjectID, savedCreds.Catalog
+		return c.Token, nil
 	}
 
-	fmt.Errorf("Token file %s does not exist ", fileName)
-
-	url := conf.Urlauth + conf.Apiverauth + "/tokens"
+	if err := a.validate(); err != nil {
+		return "", err
+	}
 
-	jsonStr, parseErr := json.Marshal(a)
+	jsonStr, parseErr := json.Marshal(a.tokenRequest())
 	if parseErr != nil {
-		fmt.Errorf("Something is wrong with auth body", parseErr)
 		return "", fmt.Errorf("Something is wrong with auth body: %v", parseErr)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	resp, body, err := c.send(conf, "POST", a.tokensURL(), "", jsonStr)
+	if err != nil {
+		return "", fmt.Errorf("Error reaching Keystone at %s: %v", a.AuthURL, err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Authentication failed: %s: %s", resp.Status, s.TrimSpace(string(body)))
+	}
 
-	tr := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("Not a valid token response: %v", err)
 	}
-	client := &http.Client{
-		Transport: &tr,
-		Timeout:   30 * time.Second,
+	c.Token = resp.Header.Get("X-Subject-Token")
+	if c.Token == "" {
+		return "", errors.New("Keystone did not return a token in the X-Subject-Token header")
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
+	c.Expires = tokenResp.Token.ExpiresAt
+	c.ProjectID = tokenResp.Token.Project.ID
+	c.Catalog = tokenResp.Token.Catalog
+	if c.ProjectID == "" {
+		return "", errors.New("The token is not scoped to a project")
 	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	jsonParsed, err := gabs.ParseJSON(body)
-
-	c.Token = jsonParsed.Path("access.token.id").String()
-	c.Token = s.Trim(c.Token, "\"")
-	var exp string = jsonParsed.Path("access.token.expires").String()
-	exp = s.Trim(exp, "\"")
-	layout := "2006-01-02T15:04:05Z"
-	c.Expires, _ = time.Parse(layout, exp)
-	credsJson, _ := json.Marshal(*c)
-	errwrite := ioutil.WriteFile(fileName, credsJson, 0644)
-	if errwrite != nil {
-		fmt.Errorf("Issues serializing token file %v\n", errwrite)
+	if errwrite := saveCachedToken(a, *c); errwrite != nil {
+		log.Printf("Issues caching token %v\n", errwrite)
 	}
 
-	return c.Token, err
+	return c.Token, nil
 }
 
 func (c *Client) getAPIClient(auth Auth, conf Config) error {
-	if c.Token == "" {
+	if c.Token == "" || !tokenValid(c.Expires) {
 		_, err := c.login(auth, conf)
 		if err != nil {
 			return fmt.Errorf("Error with credentials provided: %v", err)
@@ -162,37 +171,29 @@ func (c *Client) buildNode(auth Auth, conf Config, nodeData serverData, nodeType
 		return "", fmt.Errorf("Error with auth: %v", err)
 	}
 
-	var url = conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/servers"
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return "", err
+	}
+	var url = compute + "/servers"
 
 	jsonStr, parseErr := json.Marshal(nodeData)
 	if parseErr != nil {
 		return "", fmt.Errorf("Error with server data format: %v", parseErr)
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-	req.Header.Set("X-Auth-Token", token)
-	req.Header.Set("Content-Type", "application/json")
-
-	tr := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: &tr,
-		Timeout:   30 * time.Second,
-	}
-
-	resp, err := client.Do(req)
+	resp, body, err := c.send(conf, "POST", url, token, jsonStr)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
 
 	if isValidJSON(string(body)) == false {
-		return "", errors.New("Not a valid JSON response: " + string(body))
+		return "", fmt.Errorf("Not a valid JSON response (%s): %s", resp.Status, string(body))
 	}
 
 	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", err
+	}
 
 	var message, nodeID string
 
@@ -213,8 +214,8 @@ func (c *Client) buildNode(auth Auth, conf Config, nodeData serverData, nodeType
 		nodeID = jsonParsed.Path("server.id").String()
 		fmt.Println("nodeID:", nodeID)
 	}
-	if nodeID == "" {
-		message = "Unknown error"
+	if nodeID == "" && message == "" {
+		message = fmt.Sprintf("Unknown error: %s", resp.Status)
 	}
 	if message != "" {
 		return "", errors.New(message)
@@ -224,20 +225,6 @@ func (c *Client) buildNode(auth Auth, conf Config, nodeData serverData, nodeType
 
 }
 
-func (c *Client) downloadInitScript(url string) (string, error) {
-
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	return string(body), nil
-
-}
-
 func (c *Client) parseObj(body []byte, objNode string, idfield string, namefield string) (map[string]string, error) {
 	var objMap map[string]string = make(map[string]string)
 	jsonParsed, err := gabs.ParseJSON(body)
@@ -245,38 +232,93 @@ func (c *Client) parseObj(body []byte, objNode string, idfield string, namefield
 		return nil, err
 	}
 	if jsonParsed.Exists(objNode) {
-		ids := s.TrimLeft(jsonParsed.Path(fmt.Sprintf("%s.%s", objNode, idfield)).String(), "[")
-		ids = s.TrimRight(ids, "]")
-		idarray := s.Split(ids, ",")
-		names := s.TrimLeft(jsonParsed.Path(fmt.Sprintf("%s.%s", objNode, namefield)).String(), "[")
-		names = s.TrimRight(names, "]")
-		namearray := s.Split(names, ",")
-		count := len(idarray)
-		for i := 0; i < count; i++ {
-			objMap[idarray[i]] = namearray[i]
+		children, err := jsonParsed.S(objNode).Children()
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			id := stringField(child, idfield)
+			if id != "" {
+				objMap[id] = stringField(child, namefield)
+			}
 		}
 	}
 	return objMap, nil
 }
 
+// stringField returns the value of the field as a string, or an empty string if it is not set
+func stringField(obj *gabs.Container, field string) string {
+	v := obj.Path(field).Data()
+	if v == nil {
+		return ""
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	return fmt.Sprint(v)
+}
+
 func (c *Client) listImages(auth Auth, conf Config) (map[string]string, error) {
 	objType := "images"
-	url := conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/" + objType
-	body, err := c.listObjects(auth, conf, url, objType)
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	image, err := c.imageURL(conf)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Cannot load images. %v", err))
+		return nil, err
 	}
-	objMap, errParse := c.parseObj(body, "images", "id", "name")
-	if errParse != nil {
-		return nil, errParse
+	// Glance pages the image list. The next link of a page is relative to the root of the endpoint.
+	root := s.TrimSuffix(image, "/v2")
+	objMap := make(map[string]string)
+	for url := image + "/" + objType; url != ""; {
+		body, err := c.listObjects(auth, conf, url, objType)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Cannot load images. %v", err))
+		}
+		page, errParse := c.parseObj(body, "images", "id", "name")
+		if errParse != nil {
+			return nil, errParse
+		}
+		for id, name := range page {
+			objMap[id] = name
+		}
+		next, errNext := nextPage(body, root)
+		if errNext != nil {
+			return nil, errNext
+		}
+		if next == url {
+			return nil, fmt.Errorf("Cannot load images. The image service returned the same page twice: %s", url)
+		}
+		url = next
 	}
 
 	return objMap, nil
 }
 
+// nextPage returns the URL of the page after the given one, or an empty string if it is the last page.
+// Relative links are resolved against the root of the endpoint.
+func nextPage(body []byte, root string) (string, error) {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", err
+	}
+	next := stringField(jsonParsed, "next")
+	if next == "" || s.HasPrefix(next, "http://") || s.HasPrefix(next, "https://") {
+		return next, nil
+	}
+	return root + "/" + s.TrimLeft(next, "/"), nil
+}
+
 func (c *Client) listFlavors(auth Auth, conf Config) (map[string]string, error) {
 	objType := "flavors"
-	url := conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/" + objType
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := compute + "/" + objType
 	body, err := c.listObjects(auth, conf, url, objType)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Cannot load flavors. %v", err))
@@ -291,7 +333,14 @@ func (c *Client) listFlavors(auth Auth, conf Config) (map[string]string, error)
 
 func (c *Client) listNetworks(auth Auth, conf Config) (map[string]string, error) {
 	objType := "networks"
-	url := conf.Urlnet + conf.Apivernet + "/" + objType
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	network, err := c.networkURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := network + "/" + objType
 	body, err := c.listObjects(auth, conf, url, objType)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Cannot load networks. %v", err))
@@ -307,7 +356,14 @@ func (c *Client) listNetworks(auth Auth, conf Config) (map[string]string, error)
 
 func (c *Client) listSecGroups(auth Auth, conf Config) (map[string]string, error) {
 	objType := "os-security-groups"
-	url := conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/" + objType
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := compute + "/" + objType
 	body, err := c.listObjects(auth, conf, url, objType)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Cannot load security groups. %v", err))
@@ -322,7 +378,14 @@ func (c *Client) listSecGroups(auth Auth, conf Config) (map[string]string, error
 
 func (c *Client) listFloatingIPs(auth Auth, conf Config) (map[string]string, error) {
 	objType := "os-floating-ips"
-	url := conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/" + objType
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := compute + "/" + objType
 	body, err := c.listObjects(auth, conf, url, objType)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Cannot load security groups. %v", err))
@@ -341,7 +404,11 @@ func (c *Client) assignFloatingIP(auth Auth, conf Config, serverID string, ip st
 		return fmt.Errorf("Error with auth: %v", err)
 	}
 
-	url := conf.Urlcomp + conf.Apivercomp + "/" + auth.Body.Tenant + "/servers/" + serverID + "/action"
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return err
+	}
+	url := compute + "/servers/" + serverID + "/action"
 
 	var actionObj floatingIPAction
 	actionObj.AddFloatingIp.Address = ip
@@ -352,50 +419,153 @@ func (c *Client) assignFloatingIP(auth Auth, conf Config, serverID string, ip st
 		return fmt.Errorf("Something is wrong with auth body: %v", parseErr)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-	req.Header.Set("X-Auth-Token", token)
-	req.Header.Set("Content-Type", "application/json")
+	resp, body, err := c.send(conf, "POST", url, token, jsonStr)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Error assigning floating IP %s: %s: %s", ip, resp.Status, s.TrimSpace(string(body)))
+	}
+	return nil
+}
 
-	tr := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// removeFloatingIP disassociates the floating IP from the server, so that it can be assigned again
+func (c *Client) removeFloatingIP(auth Auth, conf Config, serverID string, ip string) error {
+	token, err := c.login(auth, conf)
+	if err != nil {
+		return fmt.Errorf("Error with auth: %v", err)
 	}
-	client := &http.Client{
-		Transport: &tr,
-		Timeout:   30 * time.Second,
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return err
 	}
-	resp, err := client.Do(req)
+	var actionObj removeFloatingIPAction
+	actionObj.RemoveFloatingIp.Address = ip
+	jsonStr, err := json.Marshal(actionObj)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("Something is wrong with action body: %v", err)
 	}
-	defer resp.Body.Close()
+	resp, body, err := c.send(conf, "POST", compute+"/servers/"+serverID+"/action", token, jsonStr)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Error releasing floating IP %s: %s: %s", ip, resp.Status, s.TrimSpace(string(body)))
+	}
+	return nil
+}
 
-	return err
+// listServers returns all the servers of the project
+func (c *Client) listServers(auth Auth, conf Config) ([]server, error) {
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return nil, err
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.listObjects(auth, conf, compute+"/servers/detail", "servers")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load servers. %v", err)
+	}
+	var servers struct {
+		Servers []server `json:"servers"`
+	}
+	if err := json.Unmarshal(body, &servers); err != nil {
+		return nil, err
+	}
+	return servers.Servers, nil
 }
 
-func (c *Client) listObjects(auth Auth, conf Config, url string, objType string) ([]byte, error) {
-	token, err := c.login(auth, conf)
+// getServer returns the server with the given ID
+func (c *Client) getServer(auth Auth, conf Config, serverID string) (server, error) {
+	var srv struct {
+		Server server `json:"server"`
+	}
+	if err := c.getAPIClient(auth, conf); err != nil {
+		return srv.Server, err
+	}
+	compute, err := c.computeURL(conf)
 	if err != nil {
-		return nil, fmt.Errorf("Error with auth: %v", err)
+		return srv.Server, err
+	}
+	body, err := c.listObjects(auth, conf, compute+"/servers/"+serverID, "servers")
+	if err != nil {
+		return srv.Server, fmt.Errorf("Cannot load server %s. %v", serverID, err)
 	}
+	err = json.Unmarshal(body, &srv)
+	return srv.Server, err
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Auth-Token", token)
+// consoleOutput returns the last lines of the console log of the server
+func (c *Client) consoleOutput(auth Auth, conf Config, serverID string, lines int) (string, error) {
+	token, err := c.login(auth, conf)
+	if err != nil {
+		return "", fmt.Errorf("Error with auth: %v", err)
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return "", err
+	}
+	var action struct {
+		GetConsoleOutput struct {
+			Length int `json:"length"`
+		} `json:"os-getConsoleOutput"`
+	}
+	action.GetConsoleOutput.Length = lines
+	jsonStr, err := json.Marshal(action)
+	if err != nil {
+		return "", err
+	}
+	resp, body, err := c.send(conf, "POST", compute+"/servers/"+serverID+"/action", token, jsonStr)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error reading the console of server %s: %s: %s", serverID, resp.Status, s.TrimSpace(string(body)))
+	}
+	var output struct {
+		Output string `json:"output"`
+	}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return "", fmt.Errorf("Not a valid console output response: %v", err)
+	}
+	return output.Output, nil
+}
 
-	tr := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// deleteServer deletes the server. Nova deletes servers asynchronously.
+func (c *Client) deleteServer(auth Auth, conf Config, serverID string) error {
+	token, err := c.login(auth, conf)
+	if err != nil {
+		return fmt.Errorf("Error with auth: %v", err)
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return err
+	}
+	resp, body, err := c.send(conf, "DELETE", compute+"/servers/"+serverID, token, nil)
+	if err != nil {
+		return err
 	}
-	client := &http.Client{
-		Transport: &tr,
-		Timeout:   30 * time.Second,
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("Error deleting server %s: %s: %s", serverID, resp.Status, s.TrimSpace(string(body)))
 	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+func (c *Client) listObjects(auth Auth, conf Config, url string, objType string) ([]byte, error) {
+	token, err := c.login(auth, conf)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("Error with auth: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
+	resp, body, err := c.send(conf, "GET", url, token, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error listing %s: %s: %s", objType, resp.Status, s.TrimSpace(string(body)))
+	}
 
 	if isValidJSON(string(body)) == false {
 		return nil, errors.New("Not a valid JSON response: " + string(body))
@@ -0,0 +1,62 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListImagesFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.RawQuery {
+		case "":
+			fmt.Fprint(w, `{"images": [{"id": "1", "name": "ubuntu"}, {"id": "2", "name": "centos"}], "next": "/v2/images?marker=2"}`)
+		case "marker=2":
+			fmt.Fprint(w, `{"images": [{"id": "3", "name": "rhel"}]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{
+		Token:   "token",
+		Expires: time.Now().Add(time.Hour),
+		Catalog: []catalogEntry{{
+			Type:      imageService,
+			Endpoints: []endpoint{{Interface: "public", URL: server.URL}},
+		}},
+	}
+	images, err := c.listImages(Auth{}, Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"1": "ubuntu", "2": "centos", "3": "rhel"}
+	if len(images) != len(expected) {
+		t.Fatalf("expected %d images, got %v", len(expected), images)
+	}
+	for id, name := range expected {
+		if images[id] != name {
+			t.Errorf("expected image %s to be %q, got %q", id, name, images[id])
+		}
+	}
+}
+
+func TestConfigDoesNotSerializeCA(t *testing.T) {
+	conf := Config{Region: "RegionOne", CACertFile: "/etc/ssl/private-ca.pem", CACert: "-----BEGIN CERTIFICATE-----"}
+	data, err := json.Marshal(KetBag{Config: conf})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "private-ca.pem") || strings.Contains(string(data), "BEGIN CERTIFICATE") {
+		t.Errorf("expected the CA bundle not to be serialized, got %s", data)
+	}
+}
@@ -0,0 +1,318 @@
+package openstack
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultProfile = "default"
+
+// configSetting binds a flag to its key in a configuration profile and to the environment variable that sets it.
+// Secrets have no key, so they are never written to the configuration file.
+type configSetting struct {
+	Flag string
+	Key  string
+	Env  string
+}
+
+// configSettings are applied in order of increasing precedence: flag defaults, the selected
+// profile of the configuration file, environment variables, and explicitly set flags
+var configSettings = []configSetting{
+	{Flag: "os-url", Key: "url", Env: "PROVISION_OS_URL"},
+	{Flag: "os-auth-url", Key: "auth_url", Env: "OS_AUTH_URL"},
+	{Flag: "os-cloud", Key: "cloud", Env: "OS_CLOUD"},
+	{Flag: "os-tenant", Key: "project_id", Env: "OS_PROJECT_ID"},
+	{Flag: "os-project-name", Key: "project_name", Env: "OS_PROJECT_NAME"},
+	{Flag: "os-project-domain", Key: "project_domain_name", Env: "OS_PROJECT_DOMAIN_NAME"},
+	{Flag: "os-user", Key: "username", Env: "OS_USERNAME"},
+	{Flag: "os-pass", Env: "OS_PASSWORD"},
+	{Flag: "os-user-domain", Key: "user_domain_name", Env: "OS_USER_DOMAIN_NAME"},
+	{Flag: "os-app-cred-id", Key: "application_credential_id", Env: "OS_APPLICATION_CREDENTIAL_ID"},
+	{Flag: "os-app-cred-secret", Env: "OS_APPLICATION_CREDENTIAL_SECRET"},
+	{Flag: "os-region", Key: "region_name", Env: "OS_REGION_NAME"},
+	{Flag: "os-interface", Key: "interface", Env: "OS_INTERFACE"},
+	{Flag: "os-cacert", Key: "cacert", Env: "OS_CACERT"},
+	{Flag: "insecure", Key: "insecure", Env: "OS_INSECURE"},
+	{Flag: "dns-ip", Key: "dns_ip", Env: "PROVISION_DNS_IP"},
+	{Flag: "domain", Key: "domain", Env: "PROVISION_DOMAIN"},
+	{Flag: "suffix", Key: "domain_suffix", Env: "PROVISION_DOMAIN_SUFFIX"},
+	{Flag: "sec-grp", Key: "security_group", Env: "PROVISION_SECURITY_GROUP"},
+	{Flag: "image", Key: "image", Env: "PROVISION_IMAGE"},
+	{Flag: "flavor", Key: "flavor", Env: "PROVISION_FLAVOR"},
+	{Flag: "network", Key: "network", Env: "PROVISION_NETWORK"},
+	{Flag: "ssh-user", Key: "ssh_user", Env: "PROVISION_SSH_USER"},
+	{Flag: "ssh-file", Key: "ssh_file", Env: "PROVISION_SSH_FILE"},
+	{Flag: "ssh-key", Key: "ssh_key", Env: "PROVISION_SSH_KEY"},
+	{Flag: "key-pair", Key: "key_pair", Env: "PROVISION_KEY_PAIR"},
+	{Flag: "install-script", Key: "install_script", Env: "PROVISION_INSTALL_SCRIPT"},
+	{Flag: "node-script", Key: "node_script", Env: "PROVISION_NODE_SCRIPT"},
+	{Flag: "cni", Key: "cni", Env: "PROVISION_CNI"},
+	{Flag: "hostname-pattern", Key: "hostname_pattern", Env: "PROVISION_HOSTNAME_PATTERN"},
+}
+
+// profile holds the values of the configuration settings, keyed by setting key
+type profile map[string]string
+
+// configFile is the user configuration file of the openstack provider
+type configFile struct {
+	CurrentProfile string             `yaml:"current_profile"`
+	Profiles       map[string]profile `yaml:"profiles"`
+}
+
+// configFilePath returns the location of the user configuration file
+func configFilePath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "provision", "openstack.yaml"), nil
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "provision", "openstack.yaml"), nil
+	}
+	return "", errors.New("neither XDG_CONFIG_HOME nor HOME are set")
+}
+
+// loadConfigFile reads the user configuration file. A missing file is an empty configuration.
+func loadConfigFile() (configFile, error) {
+	cf := configFile{Profiles: map[string]profile{}}
+	path, err := configFilePath()
+	if err != nil {
+		return cf, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cf, nil
+	}
+	if err != nil {
+		return cf, err
+	}
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return cf, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if cf.Profiles == nil {
+		cf.Profiles = map[string]profile{}
+	}
+	return cf, nil
+}
+
+// save writes the configuration file, readable only by the current user as it may hold credentials
+func (cf configFile) save() (string, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(cf)
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, data, 0600)
+}
+
+// profileName returns the profile to use: the one requested, the one in PROVISION_OPENSTACK_PROFILE,
+// the current profile of the configuration file, or the default profile.
+func (cf configFile) profileName(requested string) string {
+	if requested != "" {
+		return requested
+	}
+	if env := os.Getenv("PROVISION_OPENSTACK_PROFILE"); env != "" {
+		return env
+	}
+	if cf.CurrentProfile != "" {
+		return cf.CurrentProfile
+	}
+	return defaultProfile
+}
+
+// applyConfigLayers sets the flags that were not explicitly set from the environment, or from the
+// selected profile of the configuration file. Flags not defined in the flag set are ignored.
+func applyConfigLayers(flags *pflag.FlagSet, profileName string) error {
+	cf, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	name := cf.profileName(profileName)
+	prof, ok := cf.Profiles[name]
+	if !ok && name != defaultProfile {
+		return fmt.Errorf("profile %q not found in the configuration file. Run 'provision openstack config init --profile %s' to create it", name, name)
+	}
+	for _, s := range configSettings {
+		if flags.Lookup(s.Flag) == nil || flags.Changed(s.Flag) {
+			continue
+		}
+		value, ok := os.LookupEnv(s.Env)
+		if !ok && s.Key != "" {
+			value, ok = prof[s.Key]
+		}
+		if !ok || value == "" {
+			continue
+		}
+		if err := flags.Set(s.Flag, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, s.Flag, err)
+		}
+	}
+	return nil
+}
+
+// ConfigCmd returns the command for managing the openstack configuration profiles
+func ConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the Openstack configuration profiles.",
+		Long: `Manage the Openstack configuration profiles.
+
+Settings are read, in increasing order of precedence, from the built-in defaults, the current
+profile of the configuration file ($XDG_CONFIG_HOME/provision/openstack.yaml), environment
+variables, and command line flags. Passwords and secrets are never stored in the configuration file.`,
+	}
+	cmd.AddCommand(configInitCmd())
+	cmd.AddCommand(configUseCmd())
+	cmd.AddCommand(configListCmd())
+	return cmd
+}
+
+func configInitCmd() *cobra.Command {
+	var name string
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Interactively create or update a configuration profile.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return initProfile(name)
+		},
+	}
+	cmd.Flags().StringVarP(&name, "profile", "p", defaultProfile, "Name of the profile")
+	return cmd
+}
+
+func initProfile(name string) error {
+	cf, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	prof, ok := cf.Profiles[name]
+	if !ok {
+		prof = profile{}
+	}
+	// The descriptions of the settings are those of the create flags
+	createFlags := CreateCmd().Flags()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Configuring profile %q. Press enter to keep the value in brackets, or enter '-' to clear it. Settings left empty use their default.\n", name)
+	for _, s := range configSettings {
+		if s.Key == "" {
+			continue
+		}
+		usage, def := s.Flag, ""
+		if f := createFlags.Lookup(s.Flag); f != nil {
+			usage, def = f.Usage, f.DefValue
+		}
+		answer, err := promptSetting(reader, usage, prof[s.Key], def)
+		if err != nil {
+			return err
+		}
+		if answer == "" {
+			delete(prof, s.Key)
+			continue
+		}
+		prof[s.Key] = answer
+	}
+	cf.Profiles[name] = prof
+	if cf.CurrentProfile == "" {
+		cf.CurrentProfile = name
+	}
+	path, err := cf.save()
+	if err != nil {
+		return fmt.Errorf("error saving configuration: %v", err)
+	}
+	fmt.Printf("Profile %q saved to %s\n", name, path)
+	if cf.CurrentProfile != name {
+		fmt.Printf("Run 'provision openstack config use %s' to make it the current profile\n", name)
+	}
+	return nil
+}
+
+// promptSetting asks for the value of a setting, and returns the value to save in the profile.
+// Pressing enter keeps the saved value. Defaults are only shown, and are not saved, so that a profile
+// only holds the values the user set and later changes of the defaults still apply.
+func promptSetting(reader *bufio.Reader, usage string, saved string, def string) (string, error) {
+	switch {
+	case saved != "":
+		fmt.Printf("%s [%s]: ", usage, saved)
+	case def != "":
+		fmt.Printf("%s (default %s): ", usage, def)
+	default:
+		fmt.Printf("%s: ", usage)
+	}
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("error reading answer: %v", err)
+	}
+	switch answer = strings.TrimSpace(answer); answer {
+	case "":
+		return saved, nil
+	case "-":
+		return "", nil
+	}
+	return answer, nil
+}
+
+func configUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use PROFILE",
+		Short: "Sets the profile used when none is selected with --profile.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("the name of the profile is required")
+			}
+			cf, err := loadConfigFile()
+			if err != nil {
+				return err
+			}
+			if _, ok := cf.Profiles[args[0]]; !ok {
+				return fmt.Errorf("profile %q not found", args[0])
+			}
+			cf.CurrentProfile = args[0]
+			if _, err := cf.save(); err != nil {
+				return fmt.Errorf("error saving configuration: %v", err)
+			}
+			fmt.Printf("Using profile %q\n", args[0])
+			return nil
+		},
+	}
+}
+
+func configListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Lists the configuration profiles.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cf, err := loadConfigFile()
+			if err != nil {
+				return err
+			}
+			names := []string{}
+			for n := range cf.Profiles {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			current := cf.profileName("")
+			for _, n := range names {
+				marker := " "
+				if n == current {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\n", marker, n)
+			}
+			return nil
+		},
+	}
+}
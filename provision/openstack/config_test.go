@@ -0,0 +1,32 @@
+package openstack
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPromptSettingDoesNotSaveDefaults(t *testing.T) {
+	tests := []struct {
+		answer   string
+		saved    string
+		def      string
+		expected string
+	}{
+		{"\n", "", "kismaticuser", ""},
+		{"\n", "centos", "kismaticuser", "centos"},
+		{"-\n", "centos", "kismaticuser", ""},
+		{" ubuntu \n", "centos", "kismaticuser", "ubuntu"},
+		{"kismaticuser\n", "", "kismaticuser", "kismaticuser"},
+	}
+	for _, test := range tests {
+		value, err := promptSetting(bufio.NewReader(strings.NewReader(test.answer)), "SSH User", test.saved, test.def)
+		if err != nil {
+			t.Errorf("unexpected error for answer %q: %v", test.answer, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("answer %q with saved value %q: expected %q, got %q", test.answer, test.saved, test.expected, value)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package openstack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// handOverTimeout is how long the installer has to boot and start the orchestrator
+	handOverTimeout  = 45 * time.Minute
+	handOverInterval = 15 * time.Second
+	// installTimeout bounds the /install request, which returns once all the nodes have been created
+	installTimeout = 10 * time.Minute
+	// consoleLines is how much of the console log of the installer is searched for the fingerprint
+	consoleLines = 200
+)
+
+// errAlreadyHandedOver is returned when the orchestrator already has the cluster
+var errAlreadyHandedOver = errors.New("the orchestrator already received the cluster")
+
+// handOver waits for the orchestrator on the installer, and hands the cluster over to it. The fingerprint
+// of the orchestrator certificate is read from the console log of the installer through the Nova API, and
+// pinned, so that the cluster and its credentials only ever travel over HTTPS to that orchestrator.
+// The orchestrator accepts the cluster from the holder of the bootstrap token, which is in the user data
+// of the installer. It returns the fingerprint, which later requests to the orchestrator are pinned to.
+func handOver(a Auth, conf Config, opts KetOpts, installerID string, bag KetBag, bootstrapToken string) (string, error) {
+	c := Client{}
+	deadline := time.Now().Add(handOverTimeout)
+	srv, err := waitForServer(&c, a, conf, installerID, deadline)
+	if err != nil {
+		return "", err
+	}
+	if _, floating := srv.addresses(); len(floating) == 0 && opts.InstallNodeIP {
+		assignInstallerFloatingIP(&c, a, conf, opts, srv.ID)
+		if srv, err = c.getServer(a, conf, installerID); err != nil {
+			return "", err
+		}
+	}
+	fixed, _ := srv.addresses()
+	baseURL, err := serverURL(srv)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("Waiting for the orchestrator to publish the fingerprint of its certificate on the console of", srv.Name)
+	var fingerprint string
+	for {
+		output, err := c.consoleOutput(a, conf, installerID, consoleLines)
+		if err != nil {
+			log.Println("Error reading the console of the installer:", err)
+		} else if fp, ok := consoleFingerprint(output); ok {
+			fingerprint = fp
+			break
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out after %v waiting for the orchestrator on %s to start", handOverTimeout, srv.Name)
+		}
+		time.Sleep(handOverInterval)
+	}
+
+	fmt.Println("Handing the cluster over to the orchestrator at", baseURL)
+	body, err := json.Marshal(bag)
+	if err != nil {
+		return "", err
+	}
+	client := pinnedClient(fingerprint, installTimeout)
+	installURL := fmt.Sprintf("%s/install?ip=%s", baseURL, fixed[0])
+	for {
+		err := postCluster(client, installURL, bootstrapToken, body)
+		if err == nil || err == errAlreadyHandedOver {
+			return fingerprint, nil
+		}
+		if _, ok := err.(*url.Error); !ok || time.Now().After(deadline) {
+			return "", fmt.Errorf("error handing the cluster over to the orchestrator: %v", err)
+		}
+		// The orchestrator may still be starting
+		log.Println("Orchestrator not reachable yet:", err)
+		time.Sleep(handOverInterval)
+	}
+}
+
+// waitForServer waits until the server is active and has an IP address
+func waitForServer(c *Client, a Auth, conf Config, serverID string, deadline time.Time) (server, error) {
+	for {
+		srv, err := c.getServer(a, conf, serverID)
+		if err != nil {
+			return srv, err
+		}
+		if srv.Status == "ERROR" {
+			return srv, fmt.Errorf("server %s failed to build", srv.Name)
+		}
+		if fixed, _ := srv.addresses(); srv.Status == "ACTIVE" && len(fixed) > 0 {
+			return srv, nil
+		}
+		if time.Now().After(deadline) {
+			return srv, fmt.Errorf("timed out waiting for server %s to become active", srv.Name)
+		}
+		time.Sleep(handOverInterval)
+	}
+}
+
+// assignInstallerFloatingIP assigns an available floating IP to the installer, other than the one of
+// the ingress, so that the orchestrator can be reached from outside of the network
+func assignInstallerFloatingIP(c *Client, a Auth, conf Config, opts KetOpts, serverID string) {
+	ipList, err := c.listFloatingIPs(a, conf)
+	if err != nil {
+		fmt.Println("Cannot load floating IPs for the installer:", err)
+		return
+	}
+	for _, floatingIP := range ipList {
+		if floatingIP == opts.IngressIP {
+			continue
+		}
+		floatingIP = strings.Trim(floatingIP, "\"")
+		fmt.Println("Assigning floating IP to the installer", floatingIP)
+		if err := c.assignFloatingIP(a, conf, serverID, floatingIP); err != nil {
+			fmt.Println("Error assigning floating IP to the installer:", err)
+		}
+		return
+	}
+	fmt.Println("No floating IPs available to assign to the installer")
+}
+
+// postCluster sends the cluster to the /install endpoint of the orchestrator
+func postCluster(client *http.Client, installURL string, token string, body []byte) error {
+	req, err := http.NewRequest("POST", installURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errAlreadyHandedOver
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+}
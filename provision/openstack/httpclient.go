@@ -0,0 +1,99 @@
+package openstack
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	// GET requests are retried with an exponential backoff starting at initialBackoff
+	maxGetAttempts = 4
+	initialBackoff = 500 * time.Millisecond
+)
+
+// newHTTPClient returns an HTTP client that verifies the Openstack TLS certificates against the system
+// roots, or the CA bundle in the config. Verification is only skipped when Insecure is explicitly set.
+func newHTTPClient(conf Config) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.Insecure}
+	if conf.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(conf.CACert)) {
+			return nil, errors.New("No PEM certificates found in the CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tr := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return &http.Client{
+		Transport: tr,
+		Timeout:   requestTimeout,
+	}, nil
+}
+
+// httpClient returns the HTTP client shared by all the requests made by this client
+func (c *Client) httpClient(conf Config) (*http.Client, error) {
+	if c.http == nil {
+		client, err := newHTTPClient(conf)
+		if err != nil {
+			return nil, err
+		}
+		c.http = client
+	}
+	return c.http, nil
+}
+
+// send makes a request to an Openstack API and returns the response and its body.
+// GET requests are idempotent, so they are retried on transport errors and server errors.
+func (c *Client) send(conf Config, method string, url string, token string, body []byte) (*http.Response, []byte, error) {
+	client, err := c.httpClient(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	attempts := 1
+	if method == "GET" {
+		attempts = maxGetAttempts
+	}
+	backoff := initialBackoff
+	for i := 1; ; i++ {
+		resp, respBody, err := sendOnce(client, method, url, token, body)
+		retriable := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if !retriable || i >= attempts {
+			return resp, respBody, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func sendOnce(client *http.Client, method string, url string, token string, body []byte) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error calling %s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading response of %s %s: %v", method, url, err)
+	}
+	return resp, respBody, nil
+}
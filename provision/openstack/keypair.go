@@ -0,0 +1,145 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	s "strings"
+
+	"github.com/sashajeltuhin/ket/provision/utils"
+)
+
+type keypair struct {
+	Keypair struct {
+		Name      string `json:"name"`
+		PublicKey string `json:"public_key"`
+	} `json:"keypair"`
+}
+
+// defaultKeyPairName returns the name of the Nova keypair that is managed by this tool on this host
+func defaultKeyPairName() string {
+	thisHost, _ := os.Hostname()
+	return "kismatic-provision-" + thisHost
+}
+
+// getKeypair returns the public key of the named keypair, or an empty string if it does not exist
+func (c *Client) getKeypair(auth Auth, conf Config, name string) (string, error) {
+	token, err := c.login(auth, conf)
+	if err != nil {
+		return "", fmt.Errorf("Error with auth: %v", err)
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return "", err
+	}
+	resp, body, err := c.send(conf, "GET", compute+"/os-keypairs/"+name, token, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error getting keypair %q: %s: %s", name, resp.Status, s.TrimSpace(string(body)))
+	}
+	var kp keypair
+	if err := json.Unmarshal(body, &kp); err != nil {
+		return "", err
+	}
+	return kp.Keypair.PublicKey, nil
+}
+
+// createKeypair imports the public key as a keypair with the given name
+func (c *Client) createKeypair(auth Auth, conf Config, name string, publicKey string) error {
+	token, err := c.login(auth, conf)
+	if err != nil {
+		return fmt.Errorf("Error with auth: %v", err)
+	}
+	compute, err := c.computeURL(conf)
+	if err != nil {
+		return err
+	}
+	var kp keypair
+	kp.Keypair.Name = name
+	kp.Keypair.PublicKey = publicKey
+	jsonStr, err := json.Marshal(kp)
+	if err != nil {
+		return err
+	}
+	resp, body, err := c.send(conf, "POST", compute+"/os-keypairs", token, jsonStr)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Error creating keypair %q: %s: %s", name, resp.Status, s.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// maybeProvisionKeypair makes sure that the SSH key in the options can be used to access new servers,
+// and returns its public key. If the private key does not exist, a new one is generated. The public key
+// is then imported as a Nova keypair, unless the keypair already exists. Nova installs the keypair on
+// the servers that are created with its name.
+func maybeProvisionKeypair(auth Auth, conf Config, opts KetOpts) (string, error) {
+	publicKey, err := loadOrCreatePublicKey(opts.SSHKey)
+	if err != nil {
+		return "", err
+	}
+	c := Client{}
+	existing, err := c.getKeypair(auth, conf, opts.KeyPairName)
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		if !sameAuthorizedKey(existing, publicKey) {
+			return "", fmt.Errorf("keypair %q already exists with a different public key than %s. Use --key-pair to choose another name", opts.KeyPairName, opts.SSHKey)
+		}
+		fmt.Printf("Found keypair %q\n", opts.KeyPairName)
+		return publicKey, nil
+	}
+	fmt.Printf("Importing SSH key %s as keypair %q\n", opts.SSHKey, opts.KeyPairName)
+	if err := c.createKeypair(auth, conf, opts.KeyPairName, publicKey); err != nil {
+		return "", err
+	}
+	return publicKey, nil
+}
+
+// loadOrCreatePublicKey returns the public key of the SSH key in authorized_keys format.
+// The private key is generated if it does not exist, and the public key is written next to it.
+func loadOrCreatePublicKey(privateKeyPath string) (string, error) {
+	publicKeyPath := privateKeyPath + ".pub"
+	_, privErr := os.Stat(privateKeyPath)
+	_, pubErr := os.Stat(publicKeyPath)
+	if privErr != nil || pubErr != nil {
+		if os.IsNotExist(privErr) {
+			fmt.Printf("Generating new SSH key %s\n", privateKeyPath)
+		}
+		privateKey, err := utils.LoadOrCreatePrivateSSHKey(privateKeyPath)
+		if err != nil {
+			return "", fmt.Errorf("error loading SSH key %q: %v", privateKeyPath, err)
+		}
+		if err := utils.CreatePublicKey(privateKey, publicKeyPath); err != nil {
+			return "", fmt.Errorf("error writing public SSH key %q: %v", publicKeyPath, err)
+		}
+		// ensure correct permissions
+		os.Chmod(privateKeyPath, 0600)
+	}
+	pub, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading public SSH key %q: %v", publicKeyPath, err)
+	}
+	return s.TrimSpace(string(pub)), nil
+}
+
+// sameAuthorizedKey returns true if both keys have the same type and key material,
+// ignoring the comment.
+func sameAuthorizedKey(a, b string) bool {
+	fa := s.Fields(a)
+	fb := s.Fields(b)
+	if len(fa) < 2 || len(fb) < 2 {
+		return false
+	}
+	return fa[0] == fb[0] && fa[1] == fb[1]
+}
@@ -0,0 +1,25 @@
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// LogoutCmd returns the command that removes the cached Openstack tokens
+func LogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Removes the cached Openstack tokens.",
+		Long: `Removes the Openstack tokens cached in $XDG_CACHE_HOME/provision (~/.cache/provision by default).
+The next command will authenticate with Keystone again.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := purgeTokenCache()
+			if err != nil {
+				return fmt.Errorf("error removing cached tokens: %v", err)
+			}
+			fmt.Printf("Removed %d cached token(s)\n", n)
+			return nil
+		},
+	}
+}
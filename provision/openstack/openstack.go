@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/howeyc/gopass"
 	"github.com/sashajeltuhin/ket/provision/openstack/utils"
@@ -20,6 +22,7 @@ type KetOpts struct {
 	EtcdName        string
 	MasterName      string
 	WorkerName      string
+	HostnamePattern string
 	LeaveArtifacts  bool
 	RunKismatic     bool
 	NoPlan          bool
@@ -31,6 +34,10 @@ type KetOpts struct {
 	AdminPass       string
 	SSHUser         string
 	SSHFile         string
+	SSHKey          string
+	SSHPublicKey    string `json:",omitempty"`
+	InstallScript   string
+	NodeScript      string
 	Domain          string
 	Suffix          string
 	DNSip           string
@@ -38,13 +45,27 @@ type KetOpts struct {
 	Flavor          string
 	Network         string
 	SecGroup        string
+	Profile         string
 	OSUrl           string
+	OSAuthURL       string
+	OSCloud         string
 	OSTenant        string
+	OSProjectName   string
+	OSProjectDomain string
 	OSUser          string
 	OSUserPass      string
+	OSUserDomain    string
+	OSAppCredID     string
+	OSAppCredSecret string
+	OSRegion        string
+	OSInterface     string
+	OSCACert        string
+	Insecure        bool
 	IngressIP       string
 	CNI             string
 	InstallNodeIP   bool
+	NonInteractive  bool
+	ClusterName     string
 }
 
 func Cmd() *cobra.Command {
@@ -55,6 +76,16 @@ func Cmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(CreateCmd())
+	cmd.AddCommand(ListCmd())
+	cmd.AddCommand(DeleteCmd())
+	cmd.AddCommand(WatchCmd())
+	cmd.AddCommand(LogoutCmd())
+	cmd.AddCommand(ConfigCmd())
+	cmd.AddCommand(ImagesCmd())
+	cmd.AddCommand(FlavorsCmd())
+	cmd.AddCommand(NetworksCmd())
+	cmd.AddCommand(SecGroupsCmd())
+	cmd.AddCommand(FloatingIPsCmd())
 
 	return cmd
 }
@@ -67,9 +98,19 @@ func CreateCmd() *cobra.Command {
 		Long: `Creates infrastructure for a new cluster. 
 		
 
-Smallish instances will be created with public IP addresses. The command will not return until the instances are all online and accessible via SSH.`,
+Smallish instances will be created with public IP addresses. The command will not return until the instances are all online and accessible via SSH.
+
+Authentication uses Keystone v3 with either a user name and password or an application credential.
+Settings are read, in increasing order of precedence, from the built-in defaults, the configuration
+profile selected with --profile (see 'provision openstack config'), environment variables such as the
+standard OS_* variables, and the flags below. The cloud in clouds.yaml selected with --os-cloud
+provides any credentials that are not otherwise set.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return makeInfra(opts)
+			a, conf, err := resolveCloud(cmd.Flags(), &opts)
+			if err != nil {
+				return err
+			}
+			return makeInfra(a, conf, opts)
 		},
 	}
 
@@ -81,152 +122,287 @@ Smallish instances will be created with public IP addresses. The command will no
 	cmd.Flags().BoolVarP(&opts.Storage, "storage-cluster", "s", false, "Create a storage cluster from all Worker nodes.")
 	cmd.Flags().StringVarP(&opts.AdminPass, "admin-pass", "", "", "Admin password")
 	cmd.Flags().StringVarP(&opts.SSHUser, "ssh-user", "", "kismaticuser", "SSH User")
-	cmd.Flags().StringVarP(&opts.SSHFile, "ssh-file", "", "/ket/kismaticuser.key", "SSH File")
-	cmd.Flags().StringVarP(&opts.Domain, "domain", "", "acplab", "Domain name")
+	cmd.Flags().StringVarP(&opts.SSHFile, "ssh-file", "", "/ket/kismaticuser.key", "Path on the installer node where the SSH key the nodes are installed with is generated")
+	cmd.Flags().StringVarP(&opts.SSHKey, "ssh-key", "", "kismatic-openstack.pem", "Private SSH key used to access the servers. Generated if it does not exist")
+	cmd.Flags().StringVar(&opts.InstallScript, "install-script", "", "Path to a bootstrap script template for the installer node, used instead of the embedded one")
+	cmd.Flags().StringVar(&opts.NodeScript, "node-script", "", "Path to a bootstrap script template for the cluster nodes, used instead of the embedded one")
+	cmd.Flags().StringVarP(&opts.KeyPairName, "key-pair", "", "", "Name of the Nova keypair the SSH key is imported as. Defaults to a name derived from this host")
+	cmd.Flags().StringVarP(&opts.Domain, "domain", "", "kismatic", "Domain name")
 	cmd.Flags().StringVarP(&opts.Suffix, "suffix", "", "local", "Domain suffix")
-	cmd.Flags().StringVarP(&opts.DNSip, "dns-ip", "", "10.10.100.35", "Domain IP")
-	cmd.Flags().StringVarP(&opts.Image, "image", "", "", "Preferred Image")                       //177663bc-0c5e-43b3-99d8-7a457ae4f085
-	cmd.Flags().StringVarP(&opts.Flavor, "flavor", "", "", "Preferred Flavor")                    //f2c96d12-5454-450c-9ae6-177c4d82eaf3
-	cmd.Flags().StringVarP(&opts.Network, "network", "", "", "Preferred Network")                 //22e1a428-74a3-4fc1-bd5c-41e10b8ff617 // 7f80861a-7a75-445d-ae61-3422c39f6cc7
-	cmd.Flags().StringVarP(&opts.SecGroup, "sec-grp", "", "apprenda", "Preferred Security Group") //ket
-	cmd.Flags().StringVarP(&opts.EtcdName, "etcd-name", "", "ketautoetcd", "ETCD node name pattern")
-	cmd.Flags().StringVarP(&opts.MasterName, "master-name", "", "ketautomaster", "Master node name pattern")
-	cmd.Flags().StringVarP(&opts.WorkerName, "worker-name", "", "ketautoworker", "Worker node name pattern")
-	cmd.Flags().StringVarP(&opts.OSUrl, "os-url", "", "https://api-trial6.client.metacloud.net", "Openstack URL")
-	cmd.Flags().StringVarP(&opts.OSTenant, "os-tenant", "", "6163243e6d8c4a2f9398e24bc9f33efe", "Openstack Tenant ID")
-	cmd.Flags().StringVarP(&opts.OSUser, "os-user", "", "sasha", "Openstack User Name")
-	cmd.Flags().StringVarP(&opts.OSUserPass, "os-pass", "", "", "Openstack User Password")
+	cmd.Flags().StringVarP(&opts.DNSip, "dns-ip", "", "", "Domain IP")
+	cmd.Flags().StringVarP(&opts.Image, "image", "", "", "Preferred Image")
+	cmd.Flags().StringVarP(&opts.Flavor, "flavor", "", "", "Preferred Flavor")
+	cmd.Flags().StringVarP(&opts.Network, "network", "", "", "Preferred Network")
+	cmd.Flags().StringVarP(&opts.SecGroup, "sec-grp", "", "", "Preferred Security Group")
+	cmd.Flags().StringVarP(&opts.EtcdName, "etcd-name", "", "etcd", "Name of the ETCD nodes, used for {role} in the hostname pattern")
+	cmd.Flags().StringVarP(&opts.MasterName, "master-name", "", "master", "Name of the master nodes, used for {role} in the hostname pattern")
+	cmd.Flags().StringVarP(&opts.WorkerName, "worker-name", "", "worker", "Name of the worker nodes, used for {role} in the hostname pattern")
+	cmd.Flags().StringVar(&opts.HostnamePattern, "hostname-pattern", "", "Pattern of the hostnames of the servers. Must contain {role} and {index}, and may contain {cluster}. Defaults to {cluster}-{role}-{index}")
+	addCloudFlags(cmd, &opts)
 	cmd.Flags().StringVarP(&opts.IngressIP, "ingress-ip", "", "", "Floating IP for the ingress server")
 	cmd.Flags().StringVarP(&opts.CNI, "cni", "", "", "CNI provider. Options include: 'calico','weave','contiv','custom'")
-	cmd.Flags().BoolVarP(&opts.InstallNodeIP, "install-ip", "", true, "Set floating IP on the install node, if available. Will be used to establish ssh connection")
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster-name", "", "Name stamped in the metadata of the servers of this cluster. Defaults to a name derived from the creation time.")
+	cmd.Flags().BoolVarP(&opts.NonInteractive, "non-interactive", "", false, "Never prompt for input. Fails with the list of missing inputs instead")
+	cmd.Flags().BoolVarP(&opts.InstallNodeIP, "install-ip", "", true, "Set floating IP on the install node, if available. Will be used to reach the orchestrator")
 
 	return cmd
 }
-func makeInfra(opts KetOpts) error {
-	var conf Config
-	var a Auth
-	reader := bufio.NewReader(os.Stdin)
-	if opts.OSUrl == "" {
-		fmt.Print("Enter Openstack URL: ")
-		url, _ := reader.ReadString('\n')
-		opts.OSUrl = strings.Trim(url, "\n")
-		fmt.Print("URL: ", opts.OSUrl)
+
+// addCloudFlags adds the flags that select the Openstack cloud and credentials
+func addCloudFlags(cmd *cobra.Command, opts *KetOpts) {
+	cmd.Flags().StringVarP(&opts.Profile, "profile", "", "", "Configuration profile to read settings from. Defaults to the current profile")
+	cmd.Flags().StringVarP(&opts.OSUrl, "os-url", "", "", "Openstack URL")
+	cmd.Flags().StringVarP(&opts.OSAuthURL, "os-auth-url", "", "", "Keystone v3 URL. Defaults to port 5000 of the Openstack URL")
+	cmd.Flags().StringVarP(&opts.OSCloud, "os-cloud", "", "", "Name of the cloud in clouds.yaml to read credentials from")
+	cmd.Flags().StringVarP(&opts.OSTenant, "os-tenant", "", "", "Openstack Project (Tenant) ID")
+	cmd.Flags().StringVarP(&opts.OSProjectName, "os-project-name", "", "", "Openstack Project Name, used when the project ID is not provided")
+	cmd.Flags().StringVarP(&opts.OSProjectDomain, "os-project-domain", "", "", "Domain of the Openstack Project. Defaults to 'Default'")
+	cmd.Flags().StringVarP(&opts.OSUser, "os-user", "", "", "Openstack User Name")
+	cmd.Flags().StringVarP(&opts.OSUserPass, "os-pass", "", "", "Openstack User Password")
+	cmd.Flags().StringVarP(&opts.OSUserDomain, "os-user-domain", "", "", "Domain of the Openstack User. Defaults to 'Default'")
+	cmd.Flags().StringVarP(&opts.OSAppCredID, "os-app-cred-id", "", "", "Openstack Application Credential ID, used instead of the user name and password")
+	cmd.Flags().StringVarP(&opts.OSAppCredSecret, "os-app-cred-secret", "", "", "Openstack Application Credential Secret")
+	cmd.Flags().StringVarP(&opts.OSRegion, "os-region", "", "", "Openstack Region of the endpoints to use. Defaults to the first region in the service catalog")
+	cmd.Flags().StringVarP(&opts.OSInterface, "os-interface", "", "", "Interface of the endpoints to use from the service catalog: public, internal or admin. Defaults to public")
+	cmd.Flags().StringVarP(&opts.OSCACert, "os-cacert", "", "", "PEM bundle of the CAs used to verify the Openstack certificates. Defaults to the system roots")
+	cmd.Flags().BoolVarP(&opts.Insecure, "insecure", "", false, "Skip the verification of the Openstack certificates. Not recommended")
+}
+
+// missingInputs returns the inputs that are prompted for when they are not provided
+func missingInputs(a Auth, opts KetOpts) []string {
+	missing := a.missing()
+	inputs := []struct {
+		value string
+		desc  string
+	}{
+		{opts.DNSip, "IP of the DNS (--dns-ip)"},
+		{opts.CNI, "CNI provider (--cni)"},
+		{opts.Image, "image name or ID (--image)"},
+		{opts.Flavor, "flavor name or ID (--flavor)"},
+		{opts.Network, "network name or ID (--network)"},
+		{opts.SecGroup, "security group (--sec-grp)"},
+		{opts.AdminPass, "admin password of the cluster (--admin-pass)"},
 	}
-	if opts.OSTenant == "" {
-		fmt.Print("Openstack Tenant ID: ")
-		tenant, _ := reader.ReadString('\n') //"f4ec4723e8a541d68ef993b47ef75c94"
-		a.Body.Tenant = strings.Trim(tenant, "\n")
-	} else {
-		a.Body.Tenant = opts.OSTenant
+	for _, in := range inputs {
+		if in.value == "" {
+			missing = append(missing, in.desc)
+		}
 	}
+	return missing
+}
 
-	if opts.OSUser == "" {
-		fmt.Print("Your user name: ")
-		uname, _ := reader.ReadString('\n')
-		a.Body.Credentials.Username = strings.Trim(uname, "\n")
-	} else {
-		a.Body.Credentials.Username = opts.OSUser
+func makeInfra(a Auth, conf Config, opts KetOpts) error {
+	if opts.NonInteractive {
+		if missing := missingInputs(a, opts); len(missing) > 0 {
+			return fmt.Errorf("missing required inputs:\n  %s", strings.Join(missing, "\n  "))
+		}
 	}
+	reader := bufio.NewReader(os.Stdin)
+	var err error
+	if a.AuthURL == "" {
+		if opts.OSUrl, err = prompt(reader, "Enter Openstack URL: "); err != nil {
+			return err
+		}
+		a.AuthURL = fmt.Sprintf("%s:%s/v3", opts.OSUrl, KeystonePort)
+	}
+	if !a.usesApplicationCredential() {
+		if a.ProjectID == "" && a.ProjectName == "" {
+			if a.ProjectID, err = prompt(reader, "Openstack Project ID: "); err != nil {
+				return err
+			}
+		}
 
-	if opts.OSUserPass == "" {
-		fmt.Print("Your password: ")
-		pass, _ := gopass.GetPasswdMasked()
-		a.Body.Credentials.Password = strings.Trim(string(pass), "\n")
-	} else {
-		a.Body.Credentials.Password = opts.OSUserPass
+		if a.Username == "" {
+			if a.Username, err = prompt(reader, "Your user name: "); err != nil {
+				return err
+			}
+		}
+
+		if a.Password == "" {
+			if a.Password, err = promptPassword("Your password: "); err != nil {
+				return err
+			}
+		}
 	}
 
 	if opts.DNSip == "" {
-		fmt.Print("Provide IP of the DNS: ")
-		uname, _ := reader.ReadString('\n')
-		opts.DNSip = strings.Trim(uname, "\n")
+		if opts.DNSip, err = prompt(reader, "Provide IP of the DNS: "); err != nil {
+			return err
+		}
 	}
 
 	if opts.CNI == "" {
-		fmt.Print("CNI provider. Options include:\n 'calico','weave','contiv','custom'\n")
-		cni, _ := reader.ReadString('\n')
-		opts.CNI = strings.Trim(cni, "\n")
-	}
-
-	conf.Urlauth = fmt.Sprintf("%s:%s/", opts.OSUrl, KeystonePort)
-	conf.Apiverauth = "v2.0"
-	conf.Urlcomp = fmt.Sprintf("%s:%s/", opts.OSUrl, ComputePort)
-	conf.Apivercomp = "v2"
-	conf.Urlnet = fmt.Sprintf("%s:%s/", opts.OSUrl, NetworkPort)
-	conf.Apivernet = "v2.0"
-
-	if opts.IngressIP == "" {
-		fmt.Print("Do you want to assign a floating IP to ingress node? (y, n)")
-		answer, _ := reader.ReadString('\n')
-		answer = strings.Trim(answer, "\n")
+		if opts.CNI, err = prompt(reader, "CNI provider. Options include:\n 'calico','weave','contiv','custom'\n"); err != nil {
+			return err
+		}
+	}
+
+	if opts.IngressIP == "" && !opts.NonInteractive {
+		answer, err := prompt(reader, "Do you want to assign a floating IP to ingress node? (y, n)")
+		if err != nil {
+			return err
+		}
 		if answer == "y" || answer == "yes" {
 			ips, err := listFloatingIPs(a, conf)
 			if err != nil {
-				return errors.New(fmt.Sprintf("Cannot load images. %v. Provide your preferred image when calling the program", err))
+				return fmt.Errorf("Cannot load floating IPs. %v. Provide your preferred floating IP when calling the program", err)
 			}
 			fmt.Print("Select floating IP: \n")
-			opts.IngressIP = askForInput(ips, reader)
+			if opts.IngressIP, err = askForInput(ips, reader); err != nil {
+				return err
+			}
 		}
 	}
 
-	if opts.Image == "" {
-		images, err := listImages(a, conf)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Cannot load images. %v. Provide your preferred image when calling the program", err))
-		}
-		fmt.Print("Select Image: \n")
-		opts.Image = askForInput(images, reader)
+	if opts.Image, err = selectObject(listImages, a, conf, opts.Image, "Image", reader); err != nil {
+		return err
+	}
+	if opts.Flavor, err = selectObject(listFlavors, a, conf, opts.Flavor, "Flavor", reader); err != nil {
+		return err
+	}
+	if opts.Network, err = selectObject(listNetworks, a, conf, opts.Network, "Network", reader); err != nil {
+		return err
+	}
+	if opts.SecGroup, err = selectObject(listSecGroups, a, conf, opts.SecGroup, "Security Group", reader); err != nil {
+		return err
 	}
 
-	if opts.Flavor == "" {
-		flavors, err := listFlavors(a, conf)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Cannot load flavors. %v. Provide your preferred image when calling the program", err))
+	if opts.AdminPass == "" {
+		if opts.AdminPass, err = promptPassword("Set Admin password for the cluster: "); err != nil {
+			return err
 		}
-		fmt.Print("Select Flavor: \n")
-		opts.Flavor = askForInput(flavors, reader)
 	}
 
-	if opts.Network == "" {
-		networks, err := listNetworks(a, conf)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Cannot load networks. %v. Provide your preferred image when calling the program", err))
-		}
-		fmt.Print("Select Network: \n")
-		opts.Network = askForInput(networks, reader)
+	if opts.ClusterName == "" {
+		opts.ClusterName = "kismatic-" + strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	if !nodeNameRegexp.MatchString(opts.ClusterName) {
+		return fmt.Errorf("invalid cluster name %q. Use letters, digits, '.', '_' and '-'", opts.ClusterName)
 	}
 
-	if opts.SecGroup == "" {
-		secgroups, err := listSecGroups(a, conf)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Cannot load sec groups. %v. Provide your preferred image when calling the program", err))
-		}
-		fmt.Print("Select Security Group: \n")
-		opts.SecGroup = askForInput(secgroups, reader)
+	if _, err := expectedNodes(opts); err != nil {
+		return err
+	}
+	installerName, err := installerHostname(opts)
+	if err != nil {
+		return err
 	}
 
-	if opts.AdminPass == "" {
-		fmt.Print("Set Admin password for the cluster: ")
-		pass, _ := gopass.GetPasswdMasked()
-		opts.AdminPass = strings.Trim(string(pass), "\n")
+	if err := loadBootstrapScripts(&conf, opts); err != nil {
+		return err
+	}
+	if conf.Scripts["install"] == "" && OrchestratorVersion == "" {
+		return fmt.Errorf("this build of provision does not record the revision of the orchestrator. Build it with 'make build', or provide an installer script with --install-script")
 	}
 
-	fmt.Println("Request floating IP for installer", opts.InstallNodeIP)
+	if opts.KeyPairName == "" {
+		opts.KeyPairName = defaultKeyPairName()
+	}
+	sshPublicKey, err := maybeProvisionKeypair(a, conf, opts)
+	if err != nil {
+		return err
+	}
+	opts.SSHPublicKey = sshPublicKey
 
-	server := buildNodeData("ketautoinstall", opts)
-	var nodeID, err = buildNode(a, conf, server, opts, "install", "")
+	server := buildNodeData(installerName, opts)
+	secret, err := newSecret()
+	if err != nil {
+		return fmt.Errorf("Error generating the orchestration secret: %v", err)
+	}
+	if err := saveClusterSecret(opts.ClusterName, secret); err != nil {
+		return fmt.Errorf("Error saving the orchestration secret: %v", err)
+	}
+	// The user data of the installer only carries the token the cluster is handed over with
+	bootstrapToken, err := newSecret()
+	if err != nil {
+		return fmt.Errorf("Error generating the bootstrap token: %v", err)
+	}
+	nodeID, err := buildNode(a, conf, server, opts, "install", orchestratorEndpoint{}, "", bootstrapToken)
 
 	if err != nil {
 		fmt.Println("Error instantiating Openstack client", err)
 		return err
 	}
+	nodeID = strings.Trim(nodeID, "\"")
+	fmt.Printf("The servers are stamped with cluster name %q. To delete them, run:\n", opts.ClusterName)
+	fmt.Println("provision openstack delete --cluster " + opts.ClusterName)
 
-	fmt.Printf("Orchestration started on node %s", nodeID)
+	bag := KetBag{Auth: a, Config: conf, CACert: conf.CACert, Opts: opts, Installer: KetNode{Host: installerName}, Secret: secret}
+	fingerprint, err := handOver(a, conf, opts, nodeID, bag, bootstrapToken)
+	if err != nil {
+		return err
+	}
+	if err := saveClusterFingerprint(opts.ClusterName, fingerprint); err != nil {
+		return fmt.Errorf("Error saving the fingerprint of the orchestrator: %v", err)
+	}
+
+	fmt.Printf("Orchestration started on node %s\n", nodeID)
+	fmt.Println("To follow the installation, run:")
+	fmt.Println("provision openstack watch --cluster " + opts.ClusterName)
 
 	return nil
 }
 
-func askForInput(objList map[string]string, reader *bufio.Reader) string {
+// prompt asks a question and returns the answer without the trailing new line
+func prompt(reader *bufio.Reader, question string) (string, error) {
+	fmt.Print(question)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("Error reading answer: %v", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// promptPassword asks for a password without echoing it
+func promptPassword(question string) (string, error) {
+	fmt.Print(question)
+	pass, err := gopass.GetPasswdMasked()
+	if err != nil {
+		return "", fmt.Errorf("Error reading password: %v", err)
+	}
+	return strings.Trim(string(pass), "\n"), nil
+}
+
+// selectObject returns the ID of the object with the given name or ID. If no name or ID is given,
+// the user is asked to pick one of the objects.
+func selectObject(list func(Auth, Config) (map[string]string, error), a Auth, conf Config, value string, kind string, reader *bufio.Reader) (string, error) {
+	objList, err := list(a, conf)
+	if err != nil {
+		return "", fmt.Errorf("Cannot load %s list. %v. Provide your preferred %s when calling the program", kind, err, kind)
+	}
+	if value != "" {
+		return lookupID(objList, value, kind)
+	}
+	fmt.Printf("Select %s: \n", kind)
+	return askForInput(objList, reader)
+}
+
+// lookupID returns the ID of the object whose ID or name is the given value
+func lookupID(objList map[string]string, value string, kind string) (string, error) {
+	if _, ok := objList[value]; ok {
+		return value, nil
+	}
+	matches := []string{}
+	for id, name := range objList {
+		if name == value {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%s %q not found", kind, value)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("%s name %q is ambiguous. Use one of the IDs: %s", kind, value, strings.Join(matches, ", "))
+}
+
+// askForInput asks the user to pick one of the objects until a valid selection is made
+func askForInput(objList map[string]string, reader *bufio.Reader) (string, error) {
+	if len(objList) == 0 {
+		return "", errors.New("Nothing to select from")
+	}
 	arrPairs := utils.SortMapbyVal(objList)
 	count := len(objList)
 	var arr = make([]string, count)
@@ -235,16 +411,17 @@ func askForInput(objList map[string]string, reader *bufio.Reader) string {
 		fmt.Printf("%d - %s\n", i+1, arrPairs[i].Value)
 	}
 
-	objI, _ := reader.ReadString('\n')
-	objIndex := strings.Trim(string(objI), "\n")
-	index, _ := strconv.Atoi(objIndex)
-	if index < 1 || index > len(objList) {
-		fmt.Print("Invalid selection. Try again")
-		return askForInput(objList, reader)
-	} else {
-		objID := arr[index-1]
-		fmt.Println("You picked ", objList[objID])
-		objID = strings.Trim(objID, "\"")
-		return objID
+	for {
+		objIndex, err := prompt(reader, "")
+		if err != nil {
+			return "", err
+		}
+		index, _ := strconv.Atoi(objIndex)
+		if index >= 1 && index <= count {
+			objID := arr[index-1]
+			fmt.Println("You picked ", objList[objID])
+			return objID, nil
+		}
+		fmt.Printf("Invalid selection. Enter a number between 1 and %d: ", count)
 	}
 }
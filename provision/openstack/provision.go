@@ -3,22 +3,37 @@ package openstack
 import (
 	"bufio"
 	b64 "encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+
+	"github.com/sashajeltuhin/ket/provision/cloudinit"
 )
 
+// ketDir is where kismatic is installed on the installer node
+const ketDir = "/ket"
+
+// orchestratorPort is where the orchestrator listens on the installer node
+const orchestratorPort = "8013"
+
+// KetBag is the cluster the CLI hands over to the orchestrator on the installer, over HTTPS to the
+// pinned certificate of the orchestrator. It is never part of the user data of a server.
 type KetBag struct {
 	Auth      Auth
 	Config    Config
 	Opts      KetOpts
 	Installer KetNode
+	// Secret authenticates the requests to the orchestration API once the cluster is handed over,
+	// and the nodes derive their tokens from it
+	Secret string
+	// CACert is the CA bundle of the config, which is not serialized with it
+	CACert string `json:",omitempty"`
 }
 
 type ProvisionedNodes struct {
@@ -27,17 +42,6 @@ type ProvisionedNodes struct {
 	Worker []KetNode
 }
 
-type NodesMeta struct {
-	num  uint16
-	name string
-}
-
-type CachedNodesMeta struct {
-	Etcd   NodesMeta
-	Master NodesMeta
-	Worker NodesMeta
-}
-
 func GetClient(a Auth, conf Config) error {
 
 	c := Client{}
@@ -45,27 +49,22 @@ func GetClient(a Auth, conf Config) error {
 	return err
 }
 
-func prepNodeTemplate(auth Auth, conf Config, nodeData serverData, opts KetOpts, nodeType string, webIP string) (map[string]string, error) {
-	var tokens map[string]string = make(map[string]string)
-	bag := KetBag{Auth: auth, Config: conf, Opts: opts, Installer: KetNode{Host: nodeData.Server.Name}}
-
-	jsonStr, parseErr := json.Marshal(bag)
-	if parseErr != nil {
-		return nil, parseErr
-	}
-	tokens["nodeName"] = nodeData.Server.Name
-	tokens["webPort"] = "8013"
-	tokens["dcip"] = opts.DNSip
-	tokens["domainName"] = opts.Domain
-	tokens["domainSuf"] = opts.Suffix
-	tokens["rootPass"] = opts.AdminPass
-	tokens["nodeType"] = nodeType
-	if webIP != "" {
-		tokens["webIP"] = webIP
+// prepNodeTemplate returns the data of the bootstrap script. The user data of a server only carries
+// the token it authenticates to the orchestration API with. The installer gets the cluster from the
+// CLI over HTTPS, once the orchestrator is up.
+func prepNodeTemplate(nodeData serverData, opts KetOpts, nodeType string, web orchestratorEndpoint, authToken string) bootstrapData {
+	return bootstrapData{
+		NodeName:            nodeData.Server.Name,
+		NodeType:            nodeType,
+		WebIP:               web.IP,
+		WebPort:             orchestratorPort,
+		WebCert:             web.Certificate,
+		DNSIP:               opts.DNSip,
+		Domain:              opts.Domain,
+		DomainSuffix:        opts.Suffix,
+		AuthToken:           authToken,
+		OrchestratorVersion: OrchestratorVersion,
 	}
-	tokens["postData"] = b64.StdEncoding.EncodeToString([]byte(jsonStr))
-
-	return tokens, nil
 }
 
 func buildNodeData(name string, opts KetOpts) serverData {
@@ -73,6 +72,7 @@ func buildNodeData(name string, opts KetOpts) serverData {
 	server.Server.Name = name
 	server.Server.ImageRef = opts.Image
 	server.Server.FlavorRef = opts.Flavor
+	server.Server.Key_name = opts.KeyPairName
 	var n network
 	n.Uuid = opts.Network
 	server.Server.Networks = append(server.Server.Networks, n)
@@ -82,39 +82,49 @@ func buildNodeData(name string, opts KetOpts) serverData {
 	return server
 }
 
-func buildNode(auth Auth, conf Config, nodeData serverData, opts KetOpts, nodeType string, webIP string) (string, error) {
+// buildNode creates a server that is prepared with cloud-init like the nodes of the other providers,
+// and then runs the bootstrap script of its node type. The cluster SSH key the installer generates is
+// authorized on the other nodes, next to the key of the user. The installer authenticates to the
+// orchestration API with the shared secret, and the other nodes with their node token.
+func buildNode(auth Auth, conf Config, nodeData serverData, opts KetOpts, nodeType string, web orchestratorEndpoint, clusterPublicKey string, authToken string) (string, error) {
 	c := Client{}
-	if conf.InstallscriptURL == "" {
-		switch nodeType {
-		case "install":
-			conf.InstallscriptURL = "https://raw.githubusercontent.com/sashajeltuhin/ket/master/provision/openstack/scripts/ketinstall.sh"
-			break
-		default:
-			conf.InstallscriptURL = "https://raw.githubusercontent.com/sashajeltuhin/ket/master/provision/openstack/scripts/ketnode.sh"
-			break
-		}
-	}
-	var script, scriptErr = c.downloadInitScript(conf.InstallscriptURL)
-	if scriptErr != nil {
-		return "", fmt.Errorf("Error downloading script %v", scriptErr)
-	}
-	scriptRaw := string(script)
-	tokens, parseErr := prepNodeTemplate(auth, conf, nodeData, opts, nodeType, webIP)
-	if parseErr != nil {
-		return "", parseErr
+	data := prepNodeTemplate(nodeData, opts, nodeType, web, authToken)
+	script, version := bootstrapScript(conf, nodeType)
+	data.Version = version
+	scriptRaw, err := renderBootstrapScript(script, data)
+	if err != nil {
+		return "", err
 	}
-	for key := range tokens {
-		tokenized := "^^" + key + "^^"
-		scriptRaw = strings.Replace(scriptRaw, tokenized, tokens[key], 1)
+	userData, err := cloudinit.UserData(cloudinit.ForNode(nodeCloudConfig(nodeData.Server.Name, opts, clusterPublicKey)), scriptRaw)
+	if err != nil {
+		return "", err
 	}
-	nodeData.Server.User_data = b64.StdEncoding.EncodeToString([]byte(scriptRaw))
-	var nodeID, err = c.buildNode(auth, conf, nodeData, nodeType)
+	nodeData.Server.User_data = b64.StdEncoding.EncodeToString(userData)
+	nodeData.Server.Metadata = serverMetadata(opts.ClusterName, nodeType)
+	nodeData.Server.Metadata[bootstrapVersionKey] = version
+	nodeID, err := c.buildNode(auth, conf, nodeData, nodeType)
 	if err != nil {
 		return "", fmt.Errorf("Error spinning up node %s. Error: %v", nodeData.Server.Name, err)
 	}
 
 	return nodeID, err
 }
+
+// nodeCloudConfig describes the node to cloud-init. DNS is left to the bootstrap scripts, which
+// also register the node with the DNS server. The given public keys are authorized for the SSH user.
+func nodeCloudConfig(name string, opts KetOpts, publicKeys ...string) cloudinit.Node {
+	n := cloudinit.Node{Hostname: name}
+	if opts.Domain != "" && opts.Suffix != "" {
+		n.Domain = opts.Domain + "." + opts.Suffix
+	}
+	for _, key := range append([]string{opts.SSHPublicKey}, publicKeys...) {
+		if key != "" {
+			n.SSHAuthorizedKeys = append(n.SSHAuthorizedKeys, key)
+		}
+	}
+	return n
+}
+
 func listImages(auth Auth, conf Config) (map[string]string, error) {
 	c := Client{}
 	return c.listImages(auth, conf)
@@ -140,165 +150,78 @@ func listFloatingIPs(auth Auth, conf Config) (map[string]string, error) {
 	return c.listFloatingIPs(auth, conf)
 }
 
-func cacheNode(nodeName string, nodeIP string, bag KetBag) {
-	//sshpass -p passwd ssh-copy-id -i /ket/kismaticuser.key.pub -o StrictHostKeyChecking=no kismaticuser@nodeIP
-	args := []string{"-p", bag.Opts.AdminPass, "ssh-copy-id", "-i", "/ket/kismaticuser.key.pub", "-o", "StrictHostKeyChecking=no", fmt.Sprintf("kismaticuser@%s", nodeIP)}
-	log.Println("sshpass with args", args)
-	out, err := exec.Command("sshpass", args...).Output()
-	if err != nil {
-		log.Println("Error pushing ssh cert", out, err)
-	}
-
-	log.Println("Caching new node:", nodeName)
-	cached := KetNode{ID: nodeName, Host: nodeName, PrivateIPv4: nodeIP, PublicIPv4: nodeIP, SSHUser: bag.Opts.SSHUser}
-	cachedJson, _ := json.Marshal(cached)
-	fmt.Println("Marshaled node", string(cachedJson))
-	errwrite := ioutil.WriteFile(nodeName, cachedJson, 0644)
-	if errwrite != nil {
-		log.Printf("Issues serializing cachedJson file %v\n", errwrite)
+// ensureClusterSSHKey generates the SSH key the installer accesses the nodes with, unless it exists,
+// and returns its public key. The private key never leaves the installer, other than through /sshkey.
+func ensureClusterSSHKey(opts KetOpts) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(opts.SSHFile), 0700); err != nil {
+		return "", fmt.Errorf("error creating the directory of the cluster SSH key: %v", err)
 	}
+	return loadOrCreatePublicKey(opts.SSHFile)
 }
 
-func checkIfStartKetInstall(bag KetBag) {
-	var check bool = false
-	var nodeMeta CachedNodesMeta
-	nodeMeta.Etcd = NodesMeta{num: bag.Opts.EtcdNodeCount, name: bag.Opts.EtcdName}
-	nodeMeta.Master = NodesMeta{num: bag.Opts.MasterNodeCount, name: bag.Opts.MasterName}
-	nodeMeta.Worker = NodesMeta{num: bag.Opts.WorkerNodeCount, name: bag.Opts.WorkerName}
-	check = isCacheComplete(nodeMeta)
-	if check {
-		nodes := ProvisionedNodes{}
-		for i := 0; i < int(nodeMeta.Etcd.num); i++ {
-			fileName := buildHostName(nodeMeta.Etcd.name, i)
-			n, cacheErr := getCachedNode(fileName)
-			if cacheErr != nil {
-				log.Println("Cannot read data for node", fileName, cacheErr)
-			}
-			nodes.Etcd = append(nodes.Etcd, KetNode{ID: n.Host, Host: n.Host, PublicIPv4: n.PublicIPv4, PrivateIPv4: n.PrivateIPv4, SSHUser: bag.Opts.SSHUser})
-		}
-
-		for i := 0; i < int(nodeMeta.Master.num); i++ {
-			fileName := buildHostName(nodeMeta.Master.name, i)
-			n, cacheErr := getCachedNode(fileName)
-			if cacheErr != nil {
-				log.Println("Cannot read data for node", fileName, cacheErr)
-			}
-			nodes.Master = append(nodes.Master, KetNode{ID: n.Host, Host: n.Host, PublicIPv4: n.PublicIPv4, PrivateIPv4: n.PrivateIPv4, SSHUser: bag.Opts.SSHUser})
-		}
-
-		for i := 0; i < int(nodeMeta.Worker.num); i++ {
-			fileName := buildHostName(nodeMeta.Worker.name, i)
-			n, cacheErr := getCachedNode(fileName)
-			if cacheErr != nil {
-				log.Println("Cannot read data for node", fileName, cacheErr)
-			}
-			nodes.Worker = append(nodes.Worker, KetNode{ID: n.Host, Host: n.Host, PublicIPv4: n.PublicIPv4, PrivateIPv4: n.PrivateIPv4, SSHUser: bag.Opts.SSHUser})
-		}
-
-		//assign floating IP to the ingress, if requested
-		if bag.Opts.IngressIP != "" {
-			ingressNode, err := getCachedNode("ingress")
-			if err != nil {
-				log.Println("Cannot read ingress file", err)
-			}
-			c := Client{}
-			errIP := c.assignFloatingIP(bag.Auth, bag.Config, ingressNode.ID, bag.Opts.IngressIP)
-			if errIP != nil {
-				log.Println("Error assigning floating ip to Ingress", errIP)
-			}
+// install assigns the ingress floating IP, if requested, and installs the cluster on the registered nodes.
+// The orchestration fails when the floating IP cannot be assigned, as the ingress would not be reachable.
+func (o *Orchestrator) install(bag KetBag, reg *nodeRegistry) {
+	if bag.Opts.IngressIP != "" {
+		c := Client{}
+		errIP := c.assignFloatingIP(bag.Auth, bag.Config, reg.ingressID(), bag.Opts.IngressIP)
+		if errIP != nil {
+			log.Println("Error assigning floating ip to Ingress", errIP)
+			o.setPhase(PhaseFailed, fmt.Sprintf("Error assigning floating IP %s to the ingress node: %v", bag.Opts.IngressIP, errIP))
+			return
 		}
+	}
 
-		startInstall(bag.Opts, nodes)
+	o.setPhase(PhaseInstalling, "")
+	if err := startInstall(bag.Opts, reg.provisionedNodes(), &o.output); err != nil {
+		log.Println("Error installing Kismatic", err)
+		o.setPhase(PhaseFailed, err.Error())
+		return
 	}
+	o.setPhase(PhaseSucceeded, "")
 }
 
-func buildHostName(fileName string, i int) string {
-	if i > 0 {
-		fileName = fmt.Sprintf("%s_%s", fileName, i)
-	}
-	return fileName
+// orchestratorEndpoint is where the nodes report to the orchestrator, and the certificate they verify it with
+type orchestratorEndpoint struct {
+	IP          string
+	Certificate string
 }
 
-func provisionKetNodes(bag KetBag, ip string) error {
-	if ip == "" {
+// provisionKetNodes creates the nodes of the cluster, with the cluster public key authorized. The nodes
+// report to the orchestrator, with a token derived from the secret of the cluster. The server the
+// ingress is on is recorded in the registry.
+func provisionKetNodes(bag KetBag, web orchestratorEndpoint, clusterPublicKey string, reg *nodeRegistry) error {
+	if web.IP == "" {
 		return errors.New("To provision nodes valid IP of the installer node is required")
 	}
-	//assign floating IP to the installer, if available
-	log.Println("About to assign floating IP to installer", bag.Opts.InstallNodeIP)
-	if bag.Opts.InstallNodeIP == true {
-		c := Client{}
-		ipList, err := c.listFloatingIPs(bag.Auth, bag.Config)
-		if err == nil {
-			var found bool = false
-			for key := range ipList {
-				floatingIP := ipList[key]
-				if floatingIP != bag.Opts.IngressIP {
-					found = true
-					log.Println("Available floating IP found. Assigning...", floatingIP)
-					floatingIP = strings.Trim(floatingIP, "\"")
-					errIP := c.assignFloatingIP(bag.Auth, bag.Config, ip, floatingIP)
-					if errIP != nil {
-						log.Println("Error assigning floating ip to the install node", errIP)
-					}
-					break
-				}
-			}
-			if found == false {
-				log.Println("No floating IPs available to assign to the installer node")
-			}
-		}
-
-	}
-
-	bag.Config.InstallscriptURL = ""
-
-	for i := 0; i < int(bag.Opts.EtcdNodeCount); i++ {
-		nodeName := buildHostName(bag.Opts.EtcdName, i)
-		var _, erretcd = buildNode(bag.Auth, bag.Config, buildNodeData(nodeName, bag.Opts), bag.Opts, "etcd", ip)
-		if erretcd != nil {
-			log.Println("Error instantiating etcd node", erretcd)
-			return erretcd
-		}
-	}
-
-	for i := 0; i < int(bag.Opts.MasterNodeCount); i++ {
-		nodeName := buildHostName(bag.Opts.MasterName, i)
-		var _, errMaster = buildNode(bag.Auth, bag.Config, buildNodeData(nodeName, bag.Opts), bag.Opts, "master", ip)
-		if errMaster != nil {
-			log.Println("Error instantiating master node", errMaster)
-			return errMaster
-		}
-	}
-
-	for i := 0; i < int(bag.Opts.WorkerNodeCount); i++ {
-		nodeName := buildHostName(bag.Opts.WorkerName, i)
-		var nodeid, errWorker = buildNode(bag.Auth, bag.Config, buildNodeData(nodeName, bag.Opts), bag.Opts, "worker", ip)
-		if errWorker != nil {
-			log.Println("Error instantiating worker node", errWorker)
-			return errWorker
+	ingressRecorded := false
+	for _, n := range reg.expected {
+		nodeid, err := buildNode(bag.Auth, bag.Config, buildNodeData(n.Name, bag.Opts), bag.Opts, n.Role, web, clusterPublicKey, nodeToken(bag.Secret, n.Name))
+		if err != nil {
+			log.Printf("Error instantiating %s node %s: %v", n.Role, n.Name, err)
+			return err
 		}
 		//assume that ingress, if requested is on the first worker
-		if i == 0 && bag.Opts.IngressIP != "" {
+		if n.Role == "worker" && !ingressRecorded && bag.Opts.IngressIP != "" {
 			nodeid = strings.Trim(nodeid, "\"")
-			fmt.Println("Caching ingress node:", nodeName, nodeid)
-			cached := KetNode{ID: nodeid}
-			cachedJson, _ := json.Marshal(cached)
-			fmt.Println("Marshaled node", string(cachedJson))
-			errwrite := ioutil.WriteFile("ingress", cachedJson, 0644)
-			if errwrite != nil {
-				log.Printf("Issues serializing cachedJson file %v\n", errwrite)
+			log.Println("Ingress node:", n.Name, nodeid)
+			if err := reg.setIngressID(nodeid); err != nil {
+				log.Println("Error recording the ingress node", err)
 			}
+			ingressRecorded = true
 		}
 	}
 	return nil
 }
 
-func startInstall(opts KetOpts, nodes ProvisionedNodes) {
+// startInstall runs the kismatic install of the nodes, and writes its output to out
+func startInstall(opts KetOpts, nodes ProvisionedNodes, out io.Writer) error {
 	storageNodes := []KetNode{}
 	if opts.Storage {
 		storageNodes = []KetNode{nodes.Worker[0]}
 	}
-	fileName, err := makePlan(&Plan{
+	dir := clusterDir(opts.ClusterName)
+	fileName, err := makePlan(dir, &Plan{
 		AdminPassword:       opts.AdminPass,
 		Etcd:                nodes.Etcd,
 		Master:              nodes.Master,
@@ -312,32 +235,36 @@ func startInstall(opts KetOpts, nodes ProvisionedNodes) {
 		CNI:                 opts.CNI,
 	})
 	if err != nil {
-		log.Printf("Error creating plan", err)
-		return
+		return fmt.Errorf("Error creating plan: %v", err)
 	}
 
-	//"/ket/kismatic install apply -f " + fileName
-	errDir := os.Chdir("/ket")
-	if errDir != nil {
-		log.Println("Error switching to KET folder", errDir)
-	}
-	cmd := "/ket/kismatic"
-	args := []string{"install", "apply", "-f", fileName}
+	// Each cluster keeps its plan and generated assets in its own directory, while kismatic runs
+	// from its install directory, where it finds its ansible playbooks
+	cmd := filepath.Join(ketDir, "kismatic")
+	args := []string{"install", "apply", "-f", fileName, "--generated-assets-dir", filepath.Join(dir, "generated")}
 	log.Println("Running KET install", cmd, args)
-	out, err := exec.Command(cmd, args...).Output()
-	if err != nil {
-		log.Println("Error installing Kismatic", string(out), err)
+	install := exec.Command(cmd, args...)
+	install.Dir = ketDir
+	install.Stdout = io.MultiWriter(out, os.Stdout)
+	install.Stderr = io.MultiWriter(out, os.Stderr)
+	if err := install.Run(); err != nil {
+		return fmt.Errorf("kismatic install failed: %v", err)
 	}
-	log.Println("Kismatic Install:", string(out))
+	log.Println("Kismatic install finished")
+	return nil
 }
 
-func makePlan(pln *Plan) (string, error) {
+// makePlan writes the plan file of the cluster to its directory, and returns the name of the file
+func makePlan(dir string, pln *Plan) (string, error) {
 	template, err := template.New("planOverlay").Parse(OverlayNetworkPlan)
 	if err != nil {
 		return "", err
 	}
 
-	f, err := makeUniqueFile()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating the cluster directory: %v", err)
+	}
+	f, err := os.Create(filepath.Join(dir, "kismatic-cluster.yaml"))
 	if err != nil {
 		return "", err
 	}
@@ -349,64 +276,17 @@ func makePlan(pln *Plan) (string, error) {
 		return "", err
 	}
 
-	w.Flush()
+	if err = w.Flush(); err != nil {
+		return "", err
+	}
 	fmt.Println("To install your cluster, run:")
 	fmt.Println("./kismatic install apply -f " + f.Name())
 
 	return f.Name(), nil
 }
 
-func makeUniqueFile() (*os.File, error) {
-	filename := "/ket/kismatic-cluster.yaml"
-
-	return os.Create(filename)
-
-}
-
-func isCacheComplete(nodeMeta CachedNodesMeta) bool {
-	//check etcd
-	for i := 0; i < int(nodeMeta.Etcd.num); i++ {
-		fileName := buildHostName(nodeMeta.Etcd.name, i)
-		if doesFileExist(fileName) == false {
-			return false
-		}
-	}
-	for i := 0; i < int(nodeMeta.Master.num); i++ {
-		fileName := buildHostName(nodeMeta.Master.name, i)
-		if doesFileExist(fileName) == false {
-			return false
-		}
-	}
-	for i := 0; i < int(nodeMeta.Worker.num); i++ {
-		fileName := buildHostName(nodeMeta.Worker.name, i)
-		if doesFileExist(fileName) == false {
-			return false
-		}
-	}
-
-	log.Println("All nodes in place")
-	return true
-}
-
-func doesFileExist(fileName string) bool {
-	_, err := os.Stat(fileName)
-	if err != nil {
-		log.Println("Node is not there yet", fileName)
-		return false
-	}
-	log.Println("Node found", fileName)
-	return true
-}
-
-func getCachedNode(fileName string) (KetNode, error) {
-	var node KetNode
-	dat, readerr := ioutil.ReadFile(fileName)
-	fmt.Println("Opened node file", len(dat), readerr)
-	if readerr == nil && dat != nil && len(dat) > 0 {
-		deserr := json.Unmarshal(dat, &node)
-		return node, deserr
-	}
-
-	return node, readerr
-
+// clusterDir returns the directory on the installer where the plan file and the generated assets
+// of the cluster are kept, so that installs of different clusters do not overwrite each other
+func clusterDir(clusterName string) string {
+	return filepath.Join(ketDir, "clusters", clusterName)
 }
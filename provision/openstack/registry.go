@@ -0,0 +1,255 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sashajeltuhin/ket/provision/utils"
+)
+
+// expectedNode is a node the orchestrator waits for before installing the cluster
+type expectedNode struct {
+	Name string
+	Role string
+}
+
+// nodeHostname returns the hostname of the node with the given name and index, according to the
+// hostname pattern of the cluster
+func nodeHostname(opts KetOpts, name string, index int) (string, error) {
+	scheme, err := utils.NewHostnameScheme(opts.HostnamePattern, opts.ClusterName)
+	if err != nil {
+		return "", err
+	}
+	return scheme.Hostname(name, index)
+}
+
+// installerHostname returns the hostname of the installer of the cluster
+func installerHostname(opts KetOpts) (string, error) {
+	return nodeHostname(opts, "installer", 0)
+}
+
+// expectedNodes returns the nodes of the cluster, in the order they are created.
+// It fails if the hostname pattern yields invalid or duplicate hostnames, including the one of the installer.
+func expectedNodes(opts KetOpts) ([]expectedNode, error) {
+	nodes := []expectedNode{}
+	installer, err := installerHostname(opts)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{installer: true}
+	roles := []struct {
+		role  string
+		count uint16
+		name  string
+	}{
+		{"etcd", opts.EtcdNodeCount, opts.EtcdName},
+		{"master", opts.MasterNodeCount, opts.MasterName},
+		{"worker", opts.WorkerNodeCount, opts.WorkerName},
+	}
+	for _, r := range roles {
+		for i := 0; i < int(r.count); i++ {
+			name, err := nodeHostname(opts, r.name, i)
+			if err != nil {
+				return nil, err
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("hostname %q is used by more than one node. Use distinct node names", name)
+			}
+			seen[name] = true
+			nodes = append(nodes, expectedNode{Name: name, Role: r.role})
+		}
+	}
+	return nodes, nil
+}
+
+// registryState is the part of the registry that is persisted
+type registryState struct {
+	Cluster   string             `json:"cluster"`
+	Nodes     map[string]KetNode `json:"nodes"`
+	IngressID string             `json:"ingress_id,omitempty"`
+	Triggered bool               `json:"install_triggered"`
+}
+
+// nodeRegistry records the nodes of the cluster as they report to the orchestrator. It is safe for
+// concurrent use, and triggers the install exactly once, when all the expected nodes have registered.
+// If path is not empty, the registry is persisted to it on every change, and restored from it when created.
+// Together with the cluster the orchestrator persists, a restarted orchestrator neither forgets nodes nor
+// installs twice.
+type nodeRegistry struct {
+	mu       sync.Mutex
+	expected []expectedNode
+	sshUser  string
+	path     string
+	state    registryState
+}
+
+// newNodeRegistry returns a registry of the expected nodes of the cluster, restored from path if it exists.
+// A registry persisted for another cluster is an error, so that it never triggers the install of this one.
+func newNodeRegistry(clusterName string, expected []expectedNode, sshUser string, path string) (*nodeRegistry, error) {
+	r := &nodeRegistry{
+		expected: expected,
+		sshUser:  sshUser,
+		path:     path,
+		state:    registryState{Cluster: clusterName, Nodes: map[string]KetNode{}},
+	}
+	if path == "" {
+		return r, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading node registry: %v", err)
+	}
+	if err := json.Unmarshal(data, &r.state); err != nil {
+		return nil, fmt.Errorf("error parsing node registry %s: %v", path, err)
+	}
+	if r.state.Cluster != clusterName {
+		return nil, fmt.Errorf("node registry %s belongs to cluster %q, not %q", path, r.state.Cluster, clusterName)
+	}
+	if r.state.Nodes == nil {
+		r.state.Nodes = map[string]KetNode{}
+	}
+	return r, nil
+}
+
+// roleOf returns the role of the named node, if it is expected
+func (r *nodeRegistry) roleOf(name string) (string, bool) {
+	for _, n := range r.expected {
+		if n.Name == name {
+			return n.Role, true
+		}
+	}
+	return "", false
+}
+
+// register records the node. It returns true to exactly one caller, the one that completes
+// the registration of the expected nodes, which must then trigger the install.
+// Nodes that register again only have their IP updated.
+func (r *nodeRegistry) register(name string, role string, ip string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expectedRole, ok := r.roleOf(name)
+	if !ok {
+		return false, fmt.Errorf("node %q is not part of the cluster", name)
+	}
+	if role != expectedRole {
+		return false, fmt.Errorf("node %q is a %s node, not a %s node", name, expectedRole, role)
+	}
+	r.state.Nodes[name] = KetNode{ID: name, Host: name, PrivateIPv4: ip, PublicIPv4: ip, SSHUser: r.sshUser}
+	trigger := !r.state.Triggered && len(r.state.Nodes) == len(r.expected)
+	if trigger {
+		r.state.Triggered = true
+	}
+	if err := r.save(); err != nil {
+		// The install must not be missed because the registry could not be saved
+		log.Println("Error saving the node registry", err)
+	}
+	return trigger, nil
+}
+
+// triggered returns true once the install has been triggered
+func (r *nodeRegistry) triggered() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.Triggered
+}
+
+// setIngressID records the ID of the server the ingress floating IP is assigned to
+func (r *nodeRegistry) setIngressID(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.IngressID = id
+	return r.save()
+}
+
+func (r *nodeRegistry) ingressID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.IngressID
+}
+
+// provisionedNodes returns the registered nodes by role, in the order they were created
+func (r *nodeRegistry) provisionedNodes() ProvisionedNodes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	nodes := ProvisionedNodes{}
+	for _, e := range r.expected {
+		n, ok := r.state.Nodes[e.Name]
+		if !ok {
+			continue
+		}
+		switch e.Role {
+		case "etcd":
+			nodes.Etcd = append(nodes.Etcd, n)
+		case "master":
+			nodes.Master = append(nodes.Master, n)
+		case "worker":
+			nodes.Worker = append(nodes.Worker, n)
+		}
+	}
+	return nodes
+}
+
+// statuses returns the expected nodes, and whether they have registered
+func (r *nodeRegistry) statuses() []NodeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := []NodeStatus{}
+	for _, e := range r.expected {
+		s := NodeStatus{Name: e.Name, Role: e.Role}
+		if n, ok := r.state.Nodes[e.Name]; ok {
+			s.Registered = true
+			s.IP = n.PrivateIPv4
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// save persists the registry. It must be called with the lock held.
+func (r *nodeRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(r.state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return fmt.Errorf("error saving node registry: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file with the data, readable only by the current user. The file is
+// either replaced entirely or left as it was.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package openstack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func testOpts() KetOpts {
+	return KetOpts{
+		EtcdNodeCount:   3,
+		EtcdName:        "etcd",
+		MasterNodeCount: 2,
+		MasterName:      "master",
+		WorkerNodeCount: 5,
+		WorkerName:      "worker",
+		SSHUser:         "kismaticuser",
+		ClusterName:     "kismatic-test",
+	}
+}
+
+func mustExpectedNodes(t *testing.T, opts KetOpts) []expectedNode {
+	expected, err := expectedNodes(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return expected
+}
+
+// registerConcurrently registers every expected node the given number of times, all at once,
+// and returns how many registrations triggered the install
+func registerConcurrently(t *testing.T, reg *nodeRegistry, expected []expectedNode, times int) int32 {
+	var triggers int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < times; i++ {
+		for _, n := range expected {
+			wg.Add(1)
+			go func(n expectedNode) {
+				defer wg.Done()
+				<-start
+				trigger, err := reg.register(n.Name, n.Role, "10.0.0.1")
+				if err != nil {
+					t.Errorf("unexpected error registering %s: %v", n.Name, err)
+				}
+				if trigger {
+					atomic.AddInt32(&triggers, 1)
+				}
+			}(n)
+		}
+	}
+	close(start)
+	wg.Wait()
+	return triggers
+}
+
+func TestRegistryTriggersInstallExactlyOnce(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		expected := mustExpectedNodes(t, testOpts())
+		reg, err := newNodeRegistry("kismatic-test", expected, "kismaticuser", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if triggers := registerConcurrently(t, reg, expected, 3); triggers != 1 {
+			t.Fatalf("expected the install to be triggered once, but was triggered %d times", triggers)
+		}
+		nodes := reg.provisionedNodes()
+		if len(nodes.Etcd) != 3 || len(nodes.Master) != 2 || len(nodes.Worker) != 5 {
+			t.Errorf("unexpected provisioned nodes: %+v", nodes)
+		}
+	}
+}
+
+func TestRegistryDoesNotTriggerBeforeAllNodesRegister(t *testing.T) {
+	expected := mustExpectedNodes(t, testOpts())
+	reg, err := newNodeRegistry("kismatic-test", expected, "kismaticuser", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Register all nodes but the last, twice
+	if triggers := registerConcurrently(t, reg, expected[:len(expected)-1], 2); triggers != 0 {
+		t.Fatalf("expected no install to be triggered, but was triggered %d times", triggers)
+	}
+	last := expected[len(expected)-1]
+	trigger, err := reg.register(last.Name, last.Role, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !trigger {
+		t.Errorf("expected the last node to trigger the install")
+	}
+}
+
+func TestRegistryRejectsUnexpectedNodes(t *testing.T) {
+	reg, err := newNodeRegistry("kismatic-test", mustExpectedNodes(t, testOpts()), "kismaticuser", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := reg.register("intruder", "worker", "10.0.0.1"); err == nil {
+		t.Errorf("expected an error registering a node that is not part of the cluster")
+	}
+	if _, err := reg.register("kismatic-test-etcd-0", "worker", "10.0.0.1"); err == nil {
+		t.Errorf("expected an error registering a node with the wrong role")
+	}
+	for _, s := range reg.statuses() {
+		if s.Registered {
+			t.Errorf("node %s should not be registered", s.Name)
+		}
+	}
+}
+
+func TestExpectedNodesRejectsDuplicateHostnames(t *testing.T) {
+	opts := testOpts()
+	opts.MasterName = "etcd"
+	if _, err := expectedNodes(opts); err == nil {
+		t.Errorf("expected an error when etcd and master nodes share their hostnames")
+	}
+	opts = testOpts()
+	opts.WorkerName = "installer"
+	opts.WorkerNodeCount = 1
+	if _, err := expectedNodes(opts); err == nil {
+		t.Errorf("expected an error when a worker node has the hostname of the installer")
+	}
+	opts = testOpts()
+	opts.HostnamePattern = "{cluster}-{index}"
+	if _, err := expectedNodes(opts); err == nil {
+		t.Errorf("expected an error for a hostname pattern without {role}")
+	}
+}
+
+func TestRegistryPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nodes.json")
+
+	expected := mustExpectedNodes(t, testOpts())
+	reg, err := newNodeRegistry("kismatic-test", expected, "kismaticuser", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reg.setIngressID("server-id"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if triggers := registerConcurrently(t, reg, expected, 1); triggers != 1 {
+		t.Fatalf("expected the install to be triggered once, but was triggered %d times", triggers)
+	}
+
+	// A restarted orchestrator remembers the nodes, and does not install again
+	restored, err := newNodeRegistry("kismatic-test", expected, "kismaticuser", path)
+	if err != nil {
+		t.Fatalf("unexpected error restoring registry: %v", err)
+	}
+	if restored.ingressID() != "server-id" {
+		t.Errorf("expected ingress ID to be restored, got %q", restored.ingressID())
+	}
+	for _, s := range restored.statuses() {
+		if !s.Registered {
+			t.Errorf("node %s should have been restored", s.Name)
+		}
+	}
+	if triggers := registerConcurrently(t, restored, expected, 2); triggers != 0 {
+		t.Errorf("expected no install to be triggered after a restart, but was triggered %d times", triggers)
+	}
+}
+
+func TestRegistryOfAnotherCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nodes.json")
+
+	expected := mustExpectedNodes(t, testOpts())
+	reg, err := newNodeRegistry("kismatic-old", expected, "kismaticuser", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	registerConcurrently(t, reg, expected, 1)
+	// The leftover registry of another cluster must not trigger the install of this one
+	if _, err := newNodeRegistry("kismatic-test", expected, "kismaticuser", path); err == nil {
+		t.Errorf("expected an error restoring the registry of another cluster")
+	}
+}
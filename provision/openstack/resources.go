@@ -0,0 +1,125 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// resource is an Openstack object that can be referenced when creating a cluster
+type resource struct {
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+type resourcesByName []resource
+
+func (r resourcesByName) Len() int      { return len(r) }
+func (r resourcesByName) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r resourcesByName) Less(i, j int) bool {
+	if r[i].Name != r[j].Name {
+		return r[i].Name < r[j].Name
+	}
+	return r[i].ID < r[j].ID
+}
+
+// resourceCmd returns a command that prints the resources returned by list.
+// Resources that have no name other than their ID, such as floating IPs, are printed with the idHeader only.
+func resourceCmd(use string, short string, idHeader string, named bool, list func(Auth, Config) (map[string]string, error)) *cobra.Command {
+	opts := KetOpts{}
+	var output string
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" && output != "yaml" {
+				return fmt.Errorf("unsupported output format %q. One of table, json or yaml", output)
+			}
+			a, conf, err := resolveCloud(cmd.Flags(), &opts)
+			if err != nil {
+				return err
+			}
+			objList, err := list(a, conf)
+			if err != nil {
+				return err
+			}
+			resources := []resource{}
+			for id, name := range objList {
+				r := resource{ID: id}
+				if named {
+					r.Name = name
+				}
+				resources = append(resources, r)
+			}
+			sort.Sort(resourcesByName(resources))
+			return printResources(os.Stdout, resources, output, idHeader, named)
+		},
+	}
+	addCloudFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or yaml")
+	return cmd
+}
+
+func printResources(out io.Writer, resources []resource, output string, idHeader string, named bool) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(resources, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(resources)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, string(data))
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	if named {
+		fmt.Fprintf(w, "NAME\t%s\n", idHeader)
+	} else {
+		fmt.Fprintln(w, idHeader)
+	}
+	for _, r := range resources {
+		if named {
+			fmt.Fprintf(w, "%s\t%s\n", r.Name, r.ID)
+		} else {
+			fmt.Fprintln(w, r.ID)
+		}
+	}
+	return w.Flush()
+}
+
+// ImagesCmd returns the command that lists the images available for new servers
+func ImagesCmd() *cobra.Command {
+	return resourceCmd("images", "Lists the images available to the project.", "ID", true, listImages)
+}
+
+// FlavorsCmd returns the command that lists the server flavors
+func FlavorsCmd() *cobra.Command {
+	return resourceCmd("flavors", "Lists the server flavors available to the project.", "ID", true, listFlavors)
+}
+
+// NetworksCmd returns the command that lists the networks servers can be attached to
+func NetworksCmd() *cobra.Command {
+	return resourceCmd("networks", "Lists the networks available to the project.", "ID", true, listNetworks)
+}
+
+// SecGroupsCmd returns the command that lists the security groups
+func SecGroupsCmd() *cobra.Command {
+	return resourceCmd("secgroups", "Lists the security groups of the project.", "ID", true, listSecGroups)
+}
+
+// FloatingIPsCmd returns the command that lists the floating IPs allocated to the project
+func FloatingIPsCmd() *cobra.Command {
+	return resourceCmd("floating-ips", "Lists the floating IPs allocated to the project.", "IP", false, listFloatingIPs)
+}
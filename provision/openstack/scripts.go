@@ -0,0 +1,137 @@
+package openstack
+
+// BootstrapScriptVersion is the version of the embedded bootstrap scripts. It is recorded in the
+// metadata of the servers, and must be changed whenever the scripts change.
+// The scripts run after cloud-init has set the hostname and created the kismatic user.
+const BootstrapScriptVersion = "11"
+
+// OrchestratorVersion is the git revision of ket the installer node builds the orchestrator from.
+// It is set to the revision of the CLI when it is built, with
+// -ldflags "-X github.com/sashajeltuhin/ket/provision/openstack.OrchestratorVersion=<revision>",
+// so that the orchestrator always matches the binary that provisioned it.
+var OrchestratorVersion string
+
+// InstallScript is the template of the user data script of the installer node. It prepares the node,
+// starts the orchestrator service and prints the fingerprint of its certificate to the console, where
+// the CLI reads it before handing the cluster over.
+const InstallScript = `#!/bin/bash
+# kismatic bootstrap script version {{.Version}}
+nodeName={{quote .NodeName}}
+dcip={{quote .DNSIP}}
+domainName={{quote .Domain}}
+domainSuf={{quote .DomainSuffix}}
+webPort={{quote .WebPort}}
+authToken={{quote .AuthToken}}
+webCert={{quote .WebCert}}
+ketVersion={{quote .OrchestratorVersion}}
+sed -i "s/mirrorlist=https/mirrorlist=http/" /etc/yum.repos.d/epel.repo
+yum check-update
+yum -y install wget libcgroup cifs-utils nano openssh-clients libcgroup-tools unzip iptables-services net-tools bind bind-utils
+service cgconfig start
+echo "Updating hosts file"
+x=$(hostname -I)
+eval ipval=($x)
+ip=${ipval[0]}
+echo "$ip $nodeName" >> /etc/hosts
+echo "Updating sshd to only allow key based login"
+sed -i 's/#\?\(PermitRootLogin\s*\).*$/\1 no/' /etc/ssh/sshd_config
+sed -i 's/#\?\(PasswordAuthentication\s*\).*$/\1 no/' /etc/ssh/sshd_config
+service sshd restart
+echo "Updating domain info in resolv.conf"
+cat > /etc/resolv.conf << EOF
+nameserver $dcip
+search $domainName.$domainSuf
+domain $domainName.$domainSuf
+EOF
+chattr +i /etc/resolv.conf
+echo "Install and configure Docker"
+yum install -y yum-utils device-mapper-persistent-data lvm2
+yum-config-manager --add-repo https://download.docker.com/linux/centos/docker-ce.repo
+yum makecache fast
+yum install -y docker-ce
+touch /etc/docker/daemon.json
+cat > /etc/docker/daemon.json << EOF
+{
+  "storage-driver": "devicemapper"
+}
+EOF
+mkdir /etc/systemd/system/docker.service.d
+touch /etc/systemd/system/docker.service.d/docker.conf
+cat > /etc/systemd/system/docker.service.d/docker.conf << EOF
+[Service]
+ExecStart=
+ExecStart=/usr/bin/dockerd --exec-opt native.cgroupdriver=systemd
+EOF
+systemctl daemon-reload
+systemctl start docker
+systemctl enable docker
+
+echo "Install git"
+yum install -y git
+
+echo "Build and start the KET orchestrator service"
+git clone https://github.com/sashajeltuhin/ket.git /opt/ket
+if ! (cd /opt/ket && git checkout --detach "$ketVersion"); then
+  echo "kismatic-orchestrator-error: revision $ketVersion of ket not found" | tee /dev/console
+  exit 1
+fi
+# The state and the key of the orchestrator are only readable by root
+install -d -m 0700 /ket /ket/state /ket/tls
+docker build -t kismatic/provision-web -f /opt/ket/provision/exec/provision-web/Dockerfile /opt/ket
+docker run -d --name ket --restart unless-stopped -p 8013:8013 -v /ket:/ket -e PROVISION_WEB_BOOTSTRAP_TOKEN="$authToken" -e PROVISION_WEB_CERT_IPS="$ip" -e PROVISION_WEB_STATE_DIR=/ket/state kismatic/provision-web
+echo "Configure KET user and download KET"
+curl https://kismatic-packages-rpm.s3-accelerate.amazonaws.com/kismatic.repo -o /etc/yum.repos.d/kismatic.repo
+cd /ket
+
+wget -q -O- https://github.com/apprenda/kismatic/releases/download/v1.5.0/kismatic-v1.5.0-linux-amd64.tar.gz | tar -zxf-
+
+chmod +x ./kubectl
+mv ./kubectl /usr/local/bin/kubectl
+#cp generated/kubeconfig -p $HOME/.kube/config
+
+echo -e "server $dcip\nupdate add $nodeName.$domainName.$domainSuf 3600 A $ip\nsend\n" | nsupdate -v
+echo "Waiting for the orchestrator to listen on port $webPort"
+until [ -f /ket/tls/orchestrator.crt ]; do sleep 2; done
+fingerprint=$(openssl x509 -in /ket/tls/orchestrator.crt -noout -fingerprint -sha256 | cut -d= -f2)
+echo "kismatic-orchestrator-fingerprint: $fingerprint" | tee /dev/console
+`
+
+// NodeScript is the template of the user data script of the cluster nodes. It prepares the node
+// and reports it to the orchestrator service on the installer node.
+const NodeScript = `#!/bin/bash
+# kismatic bootstrap script version {{.Version}}
+nodeName={{quote .NodeName}}
+dcip={{quote .DNSIP}}
+domainName={{quote .Domain}}
+domainSuf={{quote .DomainSuffix}}
+nodeType={{quote .NodeType}}
+webIP={{quote .WebIP}}
+webPort={{quote .WebPort}}
+authToken={{quote .AuthToken}}
+webCert={{quote .WebCert}}
+sed -i "s/mirrorlist=https/mirrorlist=http/" /etc/yum.repos.d/epel.repo
+yum check-update
+yum -y install wget libcgroup cifs-utils nano openssh-clients libcgroup-tools unzip iptables-services net-tools bind bind-utils
+service cgconfig start
+echo "Updating hosts file"
+x=$(hostname -I)
+eval ipval=($x)
+ip=${ipval[0]}
+echo "$ip $nodeName" >> /etc/hosts
+echo "Updating sshd to only allow key based login"
+sed -i 's/#\?\(PermitRootLogin\s*\).*$/\1 no/' /etc/ssh/sshd_config
+sed -i 's/#\?\(PasswordAuthentication\s*\).*$/\1 no/' /etc/ssh/sshd_config
+service sshd restart
+echo "Updating domain info in resolv.conf"
+cat > /etc/resolv.conf << EOF
+nameserver $dcip
+search $domainName.$domainSuf
+domain $domainName.$domainSuf
+EOF
+chattr +i /etc/resolv.conf
+echo -e "server $dcip\nupdate add $nodeName.$domainName.$domainSuf 3600 A $ip\nsend\n" | nsupdate -v
+
+echo "Post to the installer that the node is done"
+echo "$webCert" > /etc/kismatic-orchestrator.crt
+wget --ca-certificate=/etc/kismatic-orchestrator.crt "https://$webIP:$webPort/nodeup?type=$nodeType&ip=$ip&name=$nodeName" --header "Authorization: Bearer $authToken" --post-data "" -o /tmp/appscale.log
+`
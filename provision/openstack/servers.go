@@ -0,0 +1,190 @@
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sashajeltuhin/ket/provision/utils"
+	"github.com/spf13/cobra"
+)
+
+// Metadata stamped on every server created by this tool
+const (
+	provisionedByKey   = "provisioned-by"
+	provisionedByValue = "kismatic"
+	clusterKey         = "kismatic-cluster"
+	roleKey            = "kismatic-role"
+	// bootstrapVersionKey records the version of the bootstrap script the server was created with
+	bootstrapVersionKey = "kismatic-bootstrap-version"
+)
+
+// serverMetadata returns the metadata that identifies a server as provisioned by this tool, for the given cluster and role
+func serverMetadata(clusterName string, nodeType string) map[string]string {
+	return map[string]string{
+		provisionedByKey: provisionedByValue,
+		clusterKey:       clusterName,
+		roleKey:          nodeType,
+	}
+}
+
+// isProvisioned returns true if the server was provisioned by this tool. If clusterName is not empty,
+// the server must also belong to the given cluster.
+func isProvisioned(srv server, clusterName string) bool {
+	if srv.Metadata[provisionedByKey] != provisionedByValue {
+		return false
+	}
+	return clusterName == "" || srv.Metadata[clusterKey] == clusterName
+}
+
+// listProvisionedServers returns the servers provisioned by this tool, optionally only those of the given cluster
+func listProvisionedServers(auth Auth, conf Config, clusterName string) ([]server, error) {
+	c := Client{}
+	servers, err := c.listServers(auth, conf)
+	if err != nil {
+		return nil, err
+	}
+	provisioned := []server{}
+	for _, srv := range servers {
+		if isProvisioned(srv, clusterName) {
+			provisioned = append(provisioned, srv)
+		}
+	}
+	return provisioned, nil
+}
+
+func printServers(out io.Writer, servers []server) {
+	tw := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprint(tw, "NAME\tCLUSTER\tROLE\tSTATUS\tIP\tFLOATING IP\n")
+	for _, srv := range servers {
+		fixed, floating := srv.addresses()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", srv.Name, srv.Metadata[clusterKey], srv.Metadata[roleKey], srv.Status, strings.Join(fixed, ","), strings.Join(floating, ","))
+	}
+	tw.Flush()
+}
+
+// ListCmd returns the command that lists the servers provisioned by this tool
+func ListCmd() *cobra.Command {
+	opts := KetOpts{}
+	var clusterName string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the servers provisioned with this tool.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, conf, err := resolveCloud(cmd.Flags(), &opts)
+			if err != nil {
+				return err
+			}
+			servers, err := listProvisionedServers(a, conf, clusterName)
+			if err != nil {
+				return err
+			}
+			printServers(os.Stdout, servers)
+			return nil
+		},
+	}
+	addCloudFlags(cmd, &opts)
+	cmd.Flags().StringVar(&clusterName, "cluster", "", "Only list the servers that belong to the given cluster.")
+	return cmd
+}
+
+type deleteOpts struct {
+	KetOpts
+	All         bool
+	ClusterName string
+	Yes         bool
+}
+
+// DeleteCmd returns the command that deletes servers provisioned by this tool
+func DeleteCmd() *cobra.Command {
+	opts := &deleteOpts{}
+	cmd := &cobra.Command{
+		Use:   "delete [NAME]",
+		Short: "Deletes servers provisioned with this tool. This will destroy servers. Be ready.",
+		Long: `Deletes servers provisioned with this tool.
+
+Only servers with the metadata stamped when they were created by this tool are considered.
+Floating IPs associated with the servers are released so that they can be assigned again.
+When the installer of a cluster is deleted, the orchestration secret kept for the cluster on this
+host is removed as well.
+
+You will be asked to confirm before any server is destroyed, unless the --yes flag is used.`,
+		Example: `# Delete a specific server
+provision openstack delete kismatic-1496255432-worker-0
+
+# Delete all servers that belong to a cluster
+provision openstack delete --cluster kismatic-1496255432
+
+# Delete all servers provisioned with this tool without asking for confirmation
+provision openstack delete --all --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doDelete(cmd, args, opts)
+		},
+	}
+	addCloudFlags(cmd, &opts.KetOpts)
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Delete all servers provisioned with this tool.")
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster", "", "Delete all servers that belong to the given cluster.")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Do not ask for confirmation before deleting servers.")
+	return cmd
+}
+
+func doDelete(cmd *cobra.Command, args []string, opts *deleteOpts) error {
+	deleteMany := opts.All || opts.ClusterName != ""
+	if !deleteMany && len(args) != 1 {
+		return errors.New("You must provide the name of the server to be deleted, or use one of the --all or --cluster flags")
+	}
+	if deleteMany && len(args) != 0 {
+		return errors.New("A server name cannot be used together with the --all or --cluster flags")
+	}
+	a, conf, err := resolveCloud(cmd.Flags(), &opts.KetOpts)
+	if err != nil {
+		return err
+	}
+	servers, err := listProvisionedServers(a, conf, opts.ClusterName)
+	if err != nil {
+		return err
+	}
+	toDelete := []server{}
+	for _, srv := range servers {
+		if deleteMany || srv.Name == args[0] {
+			toDelete = append(toDelete, srv)
+		}
+	}
+	if len(toDelete) == 0 {
+		fmt.Println("No servers to delete")
+		return nil
+	}
+
+	if !opts.Yes {
+		fmt.Println("The following servers will be destroyed:")
+		printServers(os.Stdout, toDelete)
+		if !utils.AskForConfirmation("Are you sure?") {
+			return errors.New("delete aborted")
+		}
+	}
+	c := Client{}
+	for _, srv := range toDelete {
+		_, floating := srv.addresses()
+		for _, ip := range floating {
+			if err := c.removeFloatingIP(a, conf, srv.ID, ip); err != nil {
+				return err
+			}
+			fmt.Println("Released floating IP", ip)
+		}
+		if err := c.deleteServer(a, conf, srv.ID); err != nil {
+			return err
+		}
+		fmt.Println("Deleted", srv.Name)
+		// The nodes registered with the orchestrator are kept on the installer, in the node registry,
+		// so they go with it. Only the files kept on this host for the cluster remain to be removed.
+		if srv.Metadata[roleKey] == "install" {
+			if err := removeClusterFiles(srv.Metadata[clusterKey]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
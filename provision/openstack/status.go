@@ -0,0 +1,161 @@
+package openstack
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Install phases reported by the orchestrator
+const (
+	PhaseWaitingForCluster = "waiting-for-cluster"
+	PhaseProvisioning      = "provisioning"
+	PhaseWaitingForNodes   = "waiting-for-nodes"
+	PhaseInstalling        = "installing"
+	PhaseSucceeded         = "succeeded"
+	PhaseFailed            = "failed"
+)
+
+// maxOutputBytes is how much of the kismatic output the orchestrator keeps
+const maxOutputBytes = 256 << 10
+
+// Status is the progress of the orchestration, returned by /status
+type Status struct {
+	Cluster string                `json:"cluster,omitempty"`
+	Phase   string                `json:"phase"`
+	Error   string                `json:"error,omitempty"`
+	Roles   map[string]RoleStatus `json:"roles"`
+	// Output is the kismatic output from OutputOffset, which can be requested with the since parameter
+	Output       string `json:"output,omitempty"`
+	OutputOffset int64  `json:"output_offset"`
+	OutputEnd    int64  `json:"output_end"`
+}
+
+// RoleStatus counts the nodes of a role
+type RoleStatus struct {
+	Expected   int `json:"expected"`
+	Registered int `json:"registered"`
+}
+
+// NodeStatus is a node of the cluster, returned by /nodes
+type NodeStatus struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Registered bool   `json:"registered"`
+	IP         string `json:"ip,omitempty"`
+}
+
+// outputBuffer keeps the tail of the kismatic output, and counts all the bytes written to it,
+// so that clients can request the output they have not seen yet
+type outputBuffer struct {
+	mu    sync.Mutex
+	data  []byte
+	total int64
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	b.total += int64(len(p))
+	if len(b.data) > maxOutputBytes {
+		b.data = append([]byte(nil), b.data[len(b.data)-maxOutputBytes:]...)
+	}
+	return len(p), nil
+}
+
+// since returns the output from the offset, or from the oldest byte kept, and the offsets of the
+// returned output
+func (b *outputBuffer) since(offset int64) (string, int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := b.total - int64(len(b.data))
+	if offset < start {
+		offset = start
+	}
+	if offset > b.total {
+		offset = b.total
+	}
+	return string(b.data[offset-start:]), offset, b.total
+}
+
+// setPhase records the phase of the orchestration, and the error that made it fail
+func (o *Orchestrator) setPhase(phase string, errMsg string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.phase = phase
+	o.err = errMsg
+}
+
+// nodeStatuses returns the expected nodes of the cluster, and whether they have registered
+func (o *Orchestrator) nodeStatuses() []NodeStatus {
+	o.mu.Lock()
+	reg := o.registry
+	o.mu.Unlock()
+	if reg == nil {
+		return []NodeStatus{}
+	}
+	return reg.statuses()
+}
+
+func (o *Orchestrator) status(since int64) Status {
+	o.mu.Lock()
+	s := Status{Phase: o.phase, Error: o.err, Roles: map[string]RoleStatus{}}
+	bag := o.bag
+	o.mu.Unlock()
+	if bag != nil {
+		s.Cluster = bag.Opts.ClusterName
+	}
+	for _, n := range o.nodeStatuses() {
+		r := s.Roles[n.Role]
+		r.Expected++
+		if n.Registered {
+			r.Registered++
+		}
+		s.Roles[n.Role] = r
+	}
+	s.Output, s.OutputOffset, s.OutputEnd = o.output.since(since)
+	return s
+}
+
+// getOnly authorizes GET requests with the secret of the cluster, and writes the error response otherwise
+func (o *Orchestrator) getOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if !o.authorized(r, o.clusterSecret()) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeResponse(w, http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+	return true
+}
+
+// StatusHandler returns the phase of the orchestration, the nodes per role and the kismatic output
+func (o *Orchestrator) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !o.getOnly(w, r) {
+		return
+	}
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil || since < 0 {
+			writeResponse(w, http.StatusBadRequest, "the \"since\" parameter must be a positive offset")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.status(since))
+}
+
+// NodesHandler returns the expected nodes of the cluster, and whether they have registered
+func (o *Orchestrator) NodesHandler(w http.ResponseWriter, r *http.Request) {
+	if !o.getOnly(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.nodeStatuses())
+}
@@ -0,0 +1,138 @@
+package openstack
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fingerprintMarker precedes the fingerprint of the orchestrator certificate in the console log of the
+// installer. The console log is read through the authenticated Nova API, so the fingerprint can be trusted.
+const fingerprintMarker = "kismatic-orchestrator-fingerprint:"
+
+var fingerprintRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LoadOrCreateCertificate returns the certificate the orchestrator serves HTTPS with, and its fingerprint.
+// A self-signed certificate for the given IPs is generated if the files do not exist. The CLI pins its
+// fingerprint, and the nodes trust the certificate itself, as it is passed in their user data.
+func LoadOrCreateCertificate(certFile string, keyFile string, ips []net.IP) (tls.Certificate, string, error) {
+	if _, err := os.Stat(certFile); os.IsNotExist(err) {
+		if err := createCertificate(certFile, keyFile, ips); err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("error generating the orchestrator certificate: %v", err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return cert, "", fmt.Errorf("error loading the orchestrator certificate: %v", err)
+	}
+	return cert, certFingerprint(cert.Certificate[0]), nil
+}
+
+func createCertificate(certFile string, keyFile string, ips []net.IP) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kismatic-orchestrator"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		// The certificate is its own CA for the nodes that trust it
+		IsCA:        true,
+		IPAddresses: ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// certFingerprint returns the SHA-256 fingerprint of the DER encoded certificate, in lower case hex
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseFingerprint normalizes a SHA-256 fingerprint, which may be written with colons and in upper
+// case as openssl does
+func parseFingerprint(value string) (string, error) {
+	fp := strings.ToLower(strings.Replace(strings.TrimSpace(value), ":", "", -1))
+	if !fingerprintRegexp.MatchString(fp) {
+		return "", fmt.Errorf("%q is not a SHA-256 fingerprint", value)
+	}
+	return fp, nil
+}
+
+// consoleFingerprint returns the last fingerprint of the orchestrator certificate in the console log
+func consoleFingerprint(output string) (string, bool) {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		idx := strings.Index(lines[i], fingerprintMarker)
+		if idx < 0 {
+			continue
+		}
+		if fp, err := parseFingerprint(lines[i][idx+len(fingerprintMarker):]); err == nil {
+			return fp, true
+		}
+	}
+	return "", false
+}
+
+// pinnedClient returns an HTTP client that only talks to a server presenting the certificate with the
+// given fingerprint. The connection is refused before any request is sent if the certificate does not match.
+func pinnedClient(fingerprint string, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	tr := &http.Transport{
+		DialTLS: func(network, addr string) (net.Conn, error) {
+			conn, err := tls.DialWithDialer(dialer, network, addr, &tls.Config{InsecureSkipVerify: true})
+			if err != nil {
+				return nil, err
+			}
+			certs := conn.ConnectionState().PeerCertificates
+			if len(certs) == 0 || certFingerprint(certs[0].Raw) != fingerprint {
+				conn.Close()
+				return nil, fmt.Errorf("the certificate of %s does not match the fingerprint of the orchestrator", addr)
+			}
+			return conn, nil
+		},
+	}
+	return &http.Client{Transport: tr, Timeout: timeout}
+}
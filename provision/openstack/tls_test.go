@@ -0,0 +1,79 @@
+package openstack
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ket-tls")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls", "orchestrator.crt"), filepath.Join(dir, "tls", "orchestrator.key")
+	ips := []net.IP{net.ParseIP("10.0.0.5")}
+	cert, fingerprint, err := LoadOrCreateCertificate(certFile, keyFile, ips)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cert.Certificate) == 0 || certFingerprint(cert.Certificate[0]) != fingerprint {
+		t.Errorf("expected the fingerprint of the certificate, got %s", fingerprint)
+	}
+	// A restarted orchestrator keeps its certificate, so that the pinned fingerprint stays valid
+	_, again, err := LoadOrCreateCertificate(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again != fingerprint {
+		t.Errorf("expected the certificate to be reused, got fingerprint %s instead of %s", again, fingerprint)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the key to only be readable by its owner, got %v %v", info.Mode(), err)
+	}
+}
+
+func TestConsoleFingerprint(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	// openssl prints the fingerprint in upper case, with colons between the bytes
+	openssl := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+	tests := []struct {
+		output   string
+		expected string
+		found    bool
+	}{
+		{"", "", false},
+		{"[  12.3] cloud-init[901]: kismatic-orchestrator-fingerprint: not-a-fingerprint\n", "", false},
+		{"booting\n[  12.3] cloud-init[901]: kismatic-orchestrator-fingerprint: " + openssl + "\nlogin:", fp, true},
+		{"kismatic-orchestrator-fingerprint: " + strings.Repeat("cd", 32) + "\r\nkismatic-orchestrator-fingerprint: " + fp + "\r\n", fp, true},
+	}
+	for _, test := range tests {
+		got, found := consoleFingerprint(test.output)
+		if found != test.found || got != test.expected {
+			t.Errorf("console %q: expected %q (%v), got %q (%v)", test.output, test.expected, test.found, got, found)
+		}
+	}
+}
+
+func TestPinnedClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	fingerprint := certFingerprint(server.TLS.Certificates[0].Certificate[0])
+
+	resp, err := pinnedClient(fingerprint, requestTimeout).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error with the pinned fingerprint: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := pinnedClient(strings.Repeat("0", 64), requestTimeout).Get(server.URL); err == nil {
+		t.Errorf("expected an error with another fingerprint")
+	}
+}
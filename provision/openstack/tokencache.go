@@ -0,0 +1,115 @@
+package openstack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tokens are refreshed when they are this close to expiring, so that a request does not
+// start with a token that expires before it completes
+const tokenRefreshMargin = 5 * time.Minute
+
+// tokenCacheDir returns the per-user directory where tokens are cached
+func tokenCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "provision"), nil
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".cache", "provision"), nil
+	}
+	return "", errors.New("neither XDG_CACHE_HOME nor HOME are set")
+}
+
+// tokenCacheFile returns the file where the token for the given credentials is cached.
+// The name is derived from the auth URL, project and user, so that tokens are never shared across them.
+func tokenCacheFile(a Auth) (string, error) {
+	dir, err := tokenCacheDir()
+	if err != nil {
+		return "", err
+	}
+	user := a.ApplicationCredentialID
+	if user == "" {
+		user = defaultDomain(a.UserDomainName) + "/" + a.Username
+	}
+	project := a.ProjectID
+	if project == "" {
+		project = defaultDomain(a.ProjectDomainName) + "/" + a.ProjectName
+	}
+	sum := sha256.Sum256([]byte(a.AuthURL + "\x00" + project + "\x00" + user))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".token"), nil
+}
+
+// tokenValid returns true if a token with the given expiry can still be used
+func tokenValid(expires time.Time) bool {
+	return time.Now().Add(tokenRefreshMargin).Before(expires)
+}
+
+// loadCachedToken returns the cached session for the given credentials, if it has not expired
+func loadCachedToken(a Auth) (Client, bool) {
+	var cached Client
+	fileName, err := tokenCacheFile(a)
+	if err != nil {
+		return cached, false
+	}
+	dat, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return cached, false
+	}
+	if err := json.Unmarshal(dat, &cached); err != nil {
+		return cached, false
+	}
+	if cached.Token == "" || cached.ProjectID == "" || len(cached.Catalog) == 0 || !tokenValid(cached.Expires) {
+		return cached, false
+	}
+	return cached, true
+}
+
+// saveCachedToken writes the session to the cache, readable only by the current user
+func saveCachedToken(a Auth, c Client) error {
+	fileName, err := tokenCacheFile(a)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// The file may have been created with wider permissions by someone else
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// purgeTokenCache removes all the cached tokens, and returns how many were removed
+func purgeTokenCache() (int, error) {
+	dir, err := tokenCacheDir()
+	if err != nil {
+		return 0, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.token"))
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return 0, err
+		}
+	}
+	return len(files), nil
+}
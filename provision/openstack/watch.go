@@ -0,0 +1,277 @@
+package openstack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// clusterFile returns the file with the given extension where something about the cluster is kept
+func clusterFile(clusterName string, ext string) (string, error) {
+	if !nodeNameRegexp.MatchString(clusterName) {
+		return "", fmt.Errorf("invalid cluster name %q", clusterName)
+	}
+	config, err := configFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(config), "clusters", clusterName+ext), nil
+}
+
+// clusterFileExts are the extensions of the files kept for a cluster: the orchestration secret,
+// and the fingerprint of the orchestrator certificate
+var clusterFileExts = []string{".secret", ".fingerprint"}
+
+// saveClusterFile keeps the value in the file of the cluster, readable only by the current user
+func saveClusterFile(clusterName string, ext string, value string) error {
+	fileName, err := clusterFile(clusterName, ext)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, []byte(value), 0600)
+}
+
+func loadClusterFile(clusterName string, ext string) (string, error) {
+	fileName, err := clusterFile(clusterName, ext)
+	if err != nil {
+		return "", err
+	}
+	value, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// saveClusterSecret keeps the orchestration secret of the cluster
+func saveClusterSecret(clusterName string, secret string) error {
+	return saveClusterFile(clusterName, ".secret", secret)
+}
+
+func loadClusterSecret(clusterName string) (string, error) {
+	secret, err := loadClusterFile(clusterName, ".secret")
+	if err != nil {
+		return "", fmt.Errorf("error reading the orchestration secret of cluster %q: %v", clusterName, err)
+	}
+	return secret, nil
+}
+
+// saveClusterFingerprint keeps the fingerprint of the certificate of the orchestrator of the cluster
+func saveClusterFingerprint(clusterName string, fingerprint string) error {
+	return saveClusterFile(clusterName, ".fingerprint", fingerprint)
+}
+
+func loadClusterFingerprint(clusterName string) (string, error) {
+	fingerprint, err := loadClusterFile(clusterName, ".fingerprint")
+	if err != nil {
+		return "", fmt.Errorf("error reading the fingerprint of the orchestrator of cluster %q: %v", clusterName, err)
+	}
+	return fingerprint, nil
+}
+
+// removeClusterFiles removes the files kept on this host for the cluster, once its installer is deleted
+func removeClusterFiles(clusterName string) error {
+	if !nodeNameRegexp.MatchString(clusterName) {
+		// Nothing is kept for clusters with names this tool does not create
+		return nil
+	}
+	for _, ext := range clusterFileExts {
+		fileName, err := clusterFile(clusterName, ext)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", fileName, err)
+		}
+	}
+	return nil
+}
+
+// serverURL returns the URL of the orchestration API on the server. The floating IP is preferred,
+// as the fixed IP is usually not reachable.
+func serverURL(srv server) (string, error) {
+	fixed, floating := srv.addresses()
+	addrs := append(floating, fixed...)
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("the installer %s has no IP address yet", srv.Name)
+	}
+	return "https://" + addrs[0] + ":" + orchestratorPort, nil
+}
+
+// installerURL returns the URL of the orchestration API on the installer of the cluster
+func installerURL(auth Auth, conf Config, clusterName string) (string, error) {
+	servers, err := listProvisionedServers(auth, conf, clusterName)
+	if err != nil {
+		return "", err
+	}
+	for _, srv := range servers {
+		if srv.Metadata[roleKey] == "install" {
+			return serverURL(srv)
+		}
+	}
+	return "", fmt.Errorf("no installer found for cluster %q", clusterName)
+}
+
+// errUnauthorized is returned when the orchestrator rejects the secret
+var errUnauthorized = errors.New("the orchestrator rejected the secret of the cluster")
+
+type watchOpts struct {
+	KetOpts
+	URL      string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// WatchCmd returns the command that follows the installation of a cluster
+func WatchCmd() *cobra.Command {
+	opts := &watchOpts{}
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Follows the installation of a cluster until it succeeds or fails.",
+		Long: `Follows the installation of a cluster until it succeeds or fails.
+
+The orchestrator on the installer node is polled for the nodes that have registered, the install
+phase and the kismatic output. The installer is found by its cluster name, and is reached on its
+floating IP, unless the --url flag is used. Requests are authenticated with the secret that was
+generated when the cluster was created, unless PROVISION_WEB_SECRET is set, and are only sent to the
+orchestrator whose certificate fingerprint was pinned when the cluster was handed over to it, unless
+PROVISION_WEB_FINGERPRINT is set.`,
+		Example: `# Follow the installation of a cluster
+provision openstack watch --cluster kismatic-1496255432
+
+# Follow the installation through a tunnel to the installer
+provision openstack watch --cluster kismatic-1496255432 --url https://localhost:8013`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doWatch(cmd, opts)
+		},
+	}
+	addCloudFlags(cmd, &opts.KetOpts)
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster", "", "Name of the cluster to follow.")
+	cmd.Flags().StringVar(&opts.URL, "url", "", "URL of the orchestrator. Defaults to port 8013 on the installer of the cluster.")
+	cmd.Flags().DurationVar(&opts.Interval, "interval", 10*time.Second, "How often the orchestrator is polled.")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 90*time.Minute, "How long to wait for the installation to finish.")
+	return cmd
+}
+
+func doWatch(cmd *cobra.Command, opts *watchOpts) error {
+	if opts.ClusterName == "" {
+		return errors.New("the --cluster flag is required")
+	}
+	secret := os.Getenv("PROVISION_WEB_SECRET")
+	if secret == "" {
+		var err error
+		if secret, err = loadClusterSecret(opts.ClusterName); err != nil {
+			return err
+		}
+	}
+	fingerprint := os.Getenv("PROVISION_WEB_FINGERPRINT")
+	if fingerprint == "" {
+		var err error
+		if fingerprint, err = loadClusterFingerprint(opts.ClusterName); err != nil {
+			return err
+		}
+	}
+	fingerprint, err := parseFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+	if opts.URL == "" {
+		a, conf, err := resolveCloud(cmd.Flags(), &opts.KetOpts)
+		if err != nil {
+			return err
+		}
+		if opts.URL, err = installerURL(a, conf, opts.ClusterName); err != nil {
+			return err
+		}
+	}
+	baseURL := strings.TrimSuffix(opts.URL, "/")
+	fmt.Println("Watching", baseURL)
+
+	client := pinnedClient(fingerprint, requestTimeout)
+	deadline := time.Now().Add(opts.Timeout)
+	var offset int64
+	var lastProgress string
+	for {
+		status, err := fetchStatus(client, baseURL, secret, offset)
+		if err == errUnauthorized {
+			return err
+		}
+		if err != nil {
+			// The orchestrator is not up until the installer has booted
+			fmt.Println("Orchestrator not reachable yet:", err)
+		} else {
+			if progress := formatProgress(status); progress != lastProgress {
+				fmt.Println(progress)
+				lastProgress = progress
+			}
+			fmt.Print(status.Output)
+			offset = status.OutputEnd
+			switch status.Phase {
+			case PhaseSucceeded:
+				fmt.Printf("Cluster %q installed\n", opts.ClusterName)
+				return nil
+			case PhaseFailed:
+				return fmt.Errorf("installation of cluster %q failed: %s", opts.ClusterName, status.Error)
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for the installation of cluster %q", opts.Timeout, opts.ClusterName)
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+func fetchStatus(client *http.Client, baseURL string, secret string, since int64) (Status, error) {
+	var status Status
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/status?since=%d", baseURL, since), nil)
+	if err != nil {
+		return status, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := client.Do(req)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return status, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return status, errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, &status)
+	return status, err
+}
+
+// formatProgress returns the phase and the registered nodes per role
+func formatProgress(status Status) string {
+	roles := []string{}
+	for r := range status.Roles {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	counts := []string{}
+	for _, r := range roles {
+		counts = append(counts, fmt.Sprintf("%s %d/%d", r, status.Roles[r].Registered, status.Roles[r].Expected))
+	}
+	if len(counts) == 0 {
+		return "Phase: " + status.Phase
+	}
+	return fmt.Sprintf("Phase: %s, nodes registered: %s", status.Phase, strings.Join(counts, ", "))
+}
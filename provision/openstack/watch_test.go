@@ -0,0 +1,31 @@
+package openstack
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRemoveClusterFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ket-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	oldConfig := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer os.Setenv("XDG_CONFIG_HOME", oldConfig)
+
+	if err := saveClusterSecret("prod", "secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := removeClusterFiles("prod"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := loadClusterSecret("prod"); err == nil {
+		t.Errorf("expected the secret of the cluster to be removed")
+	}
+	if err := removeClusterFiles("prod"); err != nil {
+		t.Errorf("expected no error removing the files of a cluster twice, got %v", err)
+	}
+}
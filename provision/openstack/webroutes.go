@@ -1,86 +1,421 @@
 package openstack
 
 import (
-	b64 "encoding/base64"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 )
 
+// maxBodyBytes is the largest request body accepted by the orchestration API
+const maxBodyBytes = 1 << 20
+
+// minSecretLength is the shortest secret of a cluster the orchestrator accepts
+const minSecretLength = 32
+
+// nodeNameRegexp matches the node names that are accepted by the orchestration API.
+// Node names are used as file names, so they cannot contain path separators.
+var nodeNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
 type Response struct {
 	Status string `json:"status"`
 }
 
-func parseBody(r *http.Request) (KetBag, error) {
-	//get the post data with credentials and setting
+// Orchestrator serves the orchestration API on the installer node, over HTTPS. The CLI hands the cluster
+// over with /install, and the nodes report with /nodeup once they are ready. The orchestrator generates
+// the SSH key it installs the nodes with, which can be retrieved with /sshkey.
+//
+// Requests are authenticated with a bearer token. /install accepts the bootstrap token from the user data
+// of the installer, once. The cluster carries the secret the other requests are authenticated with, and
+// each node uses a token derived from the secret and its name, so that no secret is in any user data.
+type Orchestrator struct {
+	BootstrapToken string
+	// Certificate is the PEM encoded certificate the orchestrator serves HTTPS with. The nodes verify it.
+	Certificate string
+	// StateDir is where the cluster and its registered nodes are persisted, so that a restarted orchestrator
+	// resumes with Restore. They are only kept in memory if empty.
+	StateDir string
+
+	mu       sync.Mutex
+	secret   string
+	bag      *KetBag
+	registry *nodeRegistry
+	phase    string
+	err      string
+	output   outputBuffer
+}
+
+// NewOrchestrator returns an orchestrator that accepts the cluster from the holder of the bootstrap token
+func NewOrchestrator(bootstrapToken string) *Orchestrator {
+	return &Orchestrator{BootstrapToken: bootstrapToken, phase: PhaseWaitingForCluster}
+}
+
+// stateFile returns the named file in the state directory, or an empty string if nothing is persisted
+func (o *Orchestrator) stateFile(name string) string {
+	if o.StateDir == "" {
+		return ""
+	}
+	return filepath.Join(o.StateDir, name)
+}
+
+// registryFile returns the file the nodes of the cluster are persisted to. It is named after the cluster,
+// so that the nodes of another cluster are never mistaken for its own.
+func (o *Orchestrator) registryFile(clusterName string) string {
+	return o.stateFile(clusterName + ".nodes.json")
+}
+
+// saveCluster persists the cluster, readable only by the current user, as it carries its credentials
+func (o *Orchestrator) saveCluster(bag KetBag) error {
+	path := o.stateFile("cluster.json")
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(bag)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("error saving the cluster: %v", err)
+	}
+	return nil
+}
+
+// Restore resumes the orchestration of the cluster persisted in the state directory, if any. The nodes
+// that registered before the restart are remembered. An install that was interrupted is not run again,
+// the orchestration is reported as failed instead.
+func (o *Orchestrator) Restore() error {
+	path := o.stateFile("cluster.json")
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the cluster: %v", err)
+	}
 	bag := KetBag{}
-	//	var conf Config
-	//	var nodeData serverData
-	bodyData, err := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(data, &bag); err != nil {
+		return fmt.Errorf("error parsing the cluster %s: %v", path, err)
+	}
+	if err := validateBag(bag); err != nil {
+		return fmt.Errorf("invalid cluster %s: %v", path, err)
+	}
+	expected, err := expectedNodes(bag.Opts)
+	if err != nil {
+		return err
+	}
+	reg, err := newNodeRegistry(bag.Opts.ClusterName, expected, bag.Opts.SSHUser, o.registryFile(bag.Opts.ClusterName))
 	if err != nil {
-		log.Println("Error reading body", err)
+		return err
 	}
+	bag.Config.CACert = bag.CACert
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bag = &bag
+	o.secret = bag.Secret
+	o.registry = reg
+	o.phase = PhaseWaitingForNodes
+	if reg.triggered() {
+		o.phase = PhaseFailed
+		o.err = "the orchestrator restarted after the install was started. Check the cluster, and install it again from the installer if needed"
+	}
+	return nil
+}
 
-	decoded, decerr := b64.StdEncoding.DecodeString(string(bodyData))
-	if decerr != nil {
-		log.Println("Something wrong with the post data 64bit encoding", decerr)
-		return bag, decerr
+// Handler returns the handler of the orchestration API
+func (o *Orchestrator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/install", o.ProvisionAndInstall)
+	mux.HandleFunc("/nodeup", o.NodeUp)
+	mux.HandleFunc("/status", o.StatusHandler)
+	mux.HandleFunc("/nodes", o.NodesHandler)
+	mux.HandleFunc("/sshkey", o.SSHKeyHandler)
+	return mux
+}
+
+// newSecret returns a random secret for the orchestration API
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
+
+// nodeToken returns the token the named node authenticates with
+func nodeToken(secret string, nodeName string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("nodeup:" + nodeName))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clusterSecret returns the secret of the cluster, or an empty string until the cluster is handed over
+func (o *Orchestrator) clusterSecret() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.secret
+}
 
-	unmarshErr := json.Unmarshal(decoded, &bag)
-	if unmarshErr != nil {
-		log.Println("Cannot deserialize ket bag", unmarshErr)
-		return bag, unmarshErr
+// authorized returns true if the request carries the expected token. Nothing is authorized with an empty token.
+func (o *Orchestrator) authorized(r *http.Request, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
 	}
-	fmt.Println("Bag", bag)
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func writeResponse(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(Response{Status: status})
+}
+
+// readBody reads the request body, up to maxBodyBytes
+func readBody(r *http.Request) ([]byte, int, error) {
 	defer r.Body.Close()
-	return bag, nil
+	bodyData, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("error reading body: %v", err)
+	}
+	if len(bodyData) > maxBodyBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("body is larger than %d bytes", maxBodyBytes)
+	}
+	return bodyData, http.StatusOK, nil
+}
+
+// parseBody decodes the KetBag in the request body
+func parseBody(r *http.Request) (KetBag, int, error) {
+	bag := KetBag{}
+	bodyData, code, err := readBody(r)
+	if err != nil {
+		return bag, code, err
+	}
+	if err := json.Unmarshal(bodyData, &bag); err != nil {
+		return bag, http.StatusBadRequest, fmt.Errorf("cannot deserialize ket bag: %v", err)
+	}
+	if err := validateBag(bag); err != nil {
+		return bag, http.StatusBadRequest, err
+	}
+	return bag, http.StatusOK, nil
+}
+
+func validateBag(bag KetBag) error {
+	if len(bag.Secret) < minSecretLength {
+		return fmt.Errorf("the secret of the cluster must be at least %d characters", minSecretLength)
+	}
+	if bag.Opts.SSHFile == "" || bag.Opts.SSHUser == "" {
+		return errors.New("the SSH user and key file are required")
+	}
+	if !nodeNameRegexp.MatchString(bag.Opts.ClusterName) {
+		return fmt.Errorf("invalid cluster name %q", bag.Opts.ClusterName)
+	}
+	counts := []struct {
+		kind  string
+		count uint16
+	}{
+		{"etcd", bag.Opts.EtcdNodeCount},
+		{"master", bag.Opts.MasterNodeCount},
+		{"worker", bag.Opts.WorkerNodeCount},
+	}
+	for _, c := range counts {
+		if c.count == 0 {
+			return fmt.Errorf("at least one %s node is required", c.kind)
+		}
+	}
+	_, err := expectedNodes(bag.Opts)
+	return err
 }
 
-func ProvisionAndInstall(w http.ResponseWriter, r *http.Request) {
+// queryIP returns the IP address in the named query parameter
+func queryIP(r *http.Request, name string) (string, error) {
+	ip := r.URL.Query().Get(name)
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("a valid %q parameter is required", name)
+	}
+	return ip, nil
+}
+
+// ProvisionAndInstall receives the cluster from the CLI, and creates its nodes
+func (o *Orchestrator) ProvisionAndInstall(w http.ResponseWriter, r *http.Request) {
 	log.Printf("ProvisionAndInstall called")
-	log.Println(r.URL.RawQuery)
-	q, _ := url.ParseQuery(r.URL.RawQuery)
-	var ip string = ""
-	if len(q["ip"]) > 0 {
-		ip = q["ip"][0]
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !o.authorized(r, o.BootstrapToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeResponse(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ip, err := queryIP(r, "ip")
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	bag, bodyErr := parseBody(r)
-	if bodyErr != nil {
-		log.Println("Body error", bodyErr)
+	bag, code, err := parseBody(r)
+	if err != nil {
+		log.Println("Body error", err)
+		writeResponse(w, code, err.Error())
+		return
 	}
 
-	//kick off all the requested nodes
+	expected, err := expectedNodes(bag.Opts)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	o.mu.Lock()
+	if o.bag != nil {
+		o.mu.Unlock()
+		writeResponse(w, http.StatusConflict, "cluster already received")
+		return
+	}
+	reg, err := newNodeRegistry(bag.Opts.ClusterName, expected, bag.Opts.SSHUser, o.registryFile(bag.Opts.ClusterName))
+	if err != nil {
+		o.mu.Unlock()
+		log.Println("Error creating the node registry", err)
+		writeResponse(w, http.StatusInternalServerError, "error creating the node registry")
+		return
+	}
+	bag.Config.CACert = bag.CACert
+	o.bag = &bag
+	o.secret = bag.Secret
+	o.registry = reg
+	o.phase = PhaseProvisioning
+	o.mu.Unlock()
 
-	err := provisionKetNodes(bag, ip)
+	publicKey, err := ensureClusterSSHKey(bag.Opts)
 	if err != nil {
-		log.Println("Error instantiating worker node", err)
+		log.Println("Error generating the cluster SSH key", err)
+		o.setPhase(PhaseFailed, fmt.Sprintf("error generating the cluster SSH key: %v", err))
+		writeResponse(w, http.StatusInternalServerError, "error generating the cluster SSH key")
+		return
+	}
+
+	//kick off all the requested nodes
+	if err := provisionKetNodes(bag, orchestratorEndpoint{IP: ip, Certificate: o.Certificate}, publicKey, reg); err != nil {
+		log.Println("Error instantiating nodes", err)
+		o.setPhase(PhaseFailed, fmt.Sprintf("error instantiating nodes: %v", err))
+		writeResponse(w, http.StatusInternalServerError, "error instantiating nodes")
+		return
+	}
+	// The cluster is only persisted once its nodes exist, so that a restarted orchestrator waits for them
+	if err := o.saveCluster(bag); err != nil {
+		log.Println("Error saving the cluster", err)
 	}
+	o.mu.Lock()
+	// The nodes may already have registered
+	if o.phase == PhaseProvisioning {
+		o.phase = PhaseWaitingForNodes
+	}
+	o.mu.Unlock()
+	writeResponse(w, http.StatusOK, "Provisioning nodes")
 }
 
-func NodeUp(w http.ResponseWriter, r *http.Request) {
+// NodeUp records a node that is ready, and starts the installation once all nodes are ready
+func (o *Orchestrator) NodeUp(w http.ResponseWriter, r *http.Request) {
 	log.Println("Node Up called")
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// Nodes post no data, but the body must still be read to be within limits
+	if _, code, err := readBody(r); err != nil {
+		writeResponse(w, code, err.Error())
+		return
+	}
 	q := r.URL.Query()
-	fmt.Println("received", q)
-	nodeType := q["type"][0]
-	nodeIP := q["ip"][0]
-	nodeName := q["name"][0]
+	nodeType := q.Get("type")
+	nodeName := q.Get("name")
+	if nodeType != "etcd" && nodeType != "master" && nodeType != "worker" {
+		writeResponse(w, http.StatusBadRequest, "the \"type\" parameter must be one of etcd, master or worker")
+		return
+	}
+	if !nodeNameRegexp.MatchString(nodeName) {
+		writeResponse(w, http.StatusBadRequest, "a valid \"name\" parameter is required")
+		return
+	}
+	nodeIP, err := queryIP(r, "ip")
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	expected := ""
+	if secret := o.clusterSecret(); secret != "" {
+		expected = nodeToken(secret, nodeName)
+	}
+	if !o.authorized(r, expected) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeResponse(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
 	log.Println("Parsed vals:", nodeType, nodeIP, nodeName)
 
-	bag, bodyErr := parseBody(r)
-	if bodyErr != nil {
-		log.Println("Body error", bodyErr)
+	o.mu.Lock()
+	bag, reg := o.bag, o.registry
+	o.mu.Unlock()
+	if bag == nil {
+		writeResponse(w, http.StatusConflict, "the cluster has not been received yet")
+		return
 	}
 
-	log.Println("Bag", bag)
-	//save the provisioned node
-	cacheNode(nodeName, nodeIP, bag)
+	trigger, err := reg.register(nodeName, nodeType, nodeIP)
+	if err != nil {
+		log.Println("Error registering node", err)
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeResponse(w, http.StatusOK, "Received node")
+	if trigger {
+		log.Println("All nodes in place")
+		go o.install(*bag, reg)
+	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	resp := Response{Status: "Received node"}
-	json.NewEncoder(w).Encode(resp)
-	checkIfStartKetInstall(bag)
+// SSHKeyHandler returns the private key of the cluster SSH key, which is authorized on all the nodes
+// of the cluster. It is only available once the cluster has been received.
+func (o *Orchestrator) SSHKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !o.getOnly(w, r) {
+		return
+	}
+	o.mu.Lock()
+	bag := o.bag
+	o.mu.Unlock()
+	if bag == nil {
+		writeResponse(w, http.StatusConflict, "the cluster has not been received yet")
+		return
+	}
+	key, err := ioutil.ReadFile(bag.Opts.SSHFile)
+	if err != nil {
+		log.Println("Error reading the cluster SSH key", err)
+		writeResponse(w, http.StatusNotFound, "the cluster SSH key is not available")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(key)
 }
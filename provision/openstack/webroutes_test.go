@@ -0,0 +1,170 @@
+package openstack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHKeyHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ket-sshkey")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	opts := testOpts()
+	opts.SSHFile = filepath.Join(dir, "cluster", "kismaticuser.key")
+	publicKey, err := ensureClusterSSHKey(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if publicKey == "" {
+		t.Fatalf("expected a public key")
+	}
+
+	o := NewOrchestrator("bootstrap")
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/sshkey", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		o.Handler().ServeHTTP(w, req)
+		return w
+	}
+	if w := get("bootstrap"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d with the bootstrap token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	o.bag = &KetBag{Opts: opts, Secret: "secret"}
+	o.secret = "secret"
+	if w := get(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := get(nodeToken("secret", "etcd-0")); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d with a node token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w := get("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	key, err := ioutil.ReadFile(opts.SSHFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Body.String() != string(key) {
+		t.Errorf("expected the private key of the cluster, got %q", w.Body.String())
+	}
+}
+
+func TestProvisionAndInstallRequiresTheBootstrapToken(t *testing.T) {
+	o := NewOrchestrator("bootstrap")
+	post := func(token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/install?ip=10.0.0.5", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		o.Handler().ServeHTTP(w, req)
+		return w
+	}
+	// There is no secret before the cluster is handed over, so the empty token must not be accepted
+	for _, token := range []string{"", "secret", nodeToken("", "kismatic-test-etcd-0")} {
+		if w := post(token, "{}"); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected %d with token %q, got %d", http.StatusUnauthorized, token, w.Code)
+		}
+	}
+	bag, err := json.Marshal(KetBag{Opts: testOpts(), Secret: "short"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w := post("bootstrap", string(bag)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for a cluster with a short secret, got %d", http.StatusBadRequest, w.Code)
+	}
+	if o.bag != nil {
+		t.Errorf("expected the cluster to be rejected")
+	}
+}
+
+func TestOrchestratorRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ket-state")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	opts := testOpts()
+	opts.SSHFile = filepath.Join(dir, "kismaticuser.key")
+	bag := KetBag{Opts: opts, Secret: strings.Repeat("s", minSecretLength), CACert: "ca"}
+
+	o := NewOrchestrator("bootstrap")
+	o.StateDir = filepath.Join(dir, "state")
+	if err := o.Restore(); err != nil {
+		t.Fatalf("unexpected error without a saved cluster: %v", err)
+	}
+	if o.bag != nil {
+		t.Fatalf("expected no cluster to be restored")
+	}
+	if err := o.saveCluster(bag); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(o.StateDir, "cluster.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the cluster to only be readable by its owner, got %v %v", info.Mode(), err)
+	}
+	expected := mustExpectedNodes(t, opts)
+	reg, err := newNodeRegistry(opts.ClusterName, expected, opts.SSHUser, o.registryFile(opts.ClusterName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := reg.register(expected[0].Name, expected[0].Role, "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A restarted orchestrator accepts the nodes of the cluster, and remembers those that registered
+	restarted := NewOrchestrator("bootstrap")
+	restarted.StateDir = o.StateDir
+	if err := restarted.Restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restarted.clusterSecret() != bag.Secret || restarted.bag.Config.CACert != "ca" {
+		t.Errorf("expected the cluster to be restored")
+	}
+	if restarted.phase != PhaseWaitingForNodes {
+		t.Errorf("expected phase %s, got %s", PhaseWaitingForNodes, restarted.phase)
+	}
+	if s := restarted.nodeStatuses(); !s[0].Registered || s[1].Registered {
+		t.Errorf("expected only the first node to be registered, got %v", s)
+	}
+	name := expected[1].Name
+	req := httptest.NewRequest("POST", "/nodeup?type="+expected[1].Role+"&name="+name+"&ip=10.0.0.2", nil)
+	req.Header.Set("Authorization", "Bearer "+nodeToken(bag.Secret, name))
+	w := httptest.NewRecorder()
+	restarted.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d registering a node after a restart, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestInstallFailsWhenTheIngressIPCannotBeAssigned(t *testing.T) {
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer keystone.Close()
+	opts := testOpts()
+	opts.IngressIP = "172.24.4.10"
+	reg, err := newNodeRegistry(opts.ClusterName, mustExpectedNodes(t, opts), opts.SSHUser, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auth := Auth{AuthURL: keystone.URL, Username: "user", Password: "password", ProjectName: "project"}
+
+	o := NewOrchestrator("bootstrap")
+	o.install(KetBag{Auth: auth, Opts: opts}, reg)
+	status := o.status(0)
+	if status.Phase != PhaseFailed || !strings.Contains(status.Error, opts.IngressIP) {
+		t.Errorf("expected the orchestration to fail on the floating IP, got %q: %q", status.Phase, status.Error)
+	}
+}
@@ -1,6 +1,7 @@
 package packet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -9,8 +10,9 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
 	"github.com/packethost/packngo"
+	"github.com/sashajeltuhin/ket/provision/cloudinit"
+	"github.com/sashajeltuhin/ket/provision/plan"
 )
 
 // OS is an operating system supported on Packet
@@ -19,11 +21,22 @@ type OS string
 // Region where nodes are deployed
 type Region string
 
+// HardwarePlan is the type of the Packet machine
+type HardwarePlan string
+
 const (
 	// Ubuntu1604LTS OS image
 	Ubuntu1604LTS = OS("ubuntu_16_04_image")
+	// Ubuntu1804LTS OS image
+	Ubuntu1804LTS = OS("ubuntu_18_04")
+	// Ubuntu2004LTS OS image
+	Ubuntu2004LTS = OS("ubuntu_20_04")
 	// CentOS7 OS image
 	CentOS7 = OS("centos_7_image")
+	// RHEL7 OS image
+	RHEL7 = OS("rhel_7")
+	// RHEL8 OS image
+	RHEL8 = OS("rhel_8")
 	// USEast region
 	USEast = Region("ewr1")
 	// USWest region
@@ -59,25 +72,56 @@ func newFromEnv() (*Client, error) {
 	}, nil
 }
 
-// CreateNode creates a node in packet with the given hostname and OS
-func (c Client) CreateNode(hostname string, os OS, region Region) (string, error) {
-	device := &packngo.DeviceCreateRequest{
+// deviceCreateRequest is a device create request that attaches project SSH keys to the device.
+// packngo does not support attaching keys, so the request is sent with the API client directly.
+type deviceCreateRequest struct {
+	*packngo.DeviceCreateRequest
+	ProjectSSHKeys []string `json:"project_ssh_keys,omitempty"`
+}
+
+// CreateNode creates a node in packet with the given hostname, OS and hardware plan, with the
+// given project SSH key attached. The node is tagged as provisioned by this tool, from this host,
+// for the given cluster, with the user that can SSH into it, and is prepared for the cluster with cloud-init.
+func (c Client) CreateNode(hostname string, os OS, sshUser string, sshKeyID string, hwPlan HardwarePlan, region Region, clusterName string) (string, error) {
+	userData, err := c.userData(hostname)
+	if err != nil {
+		return "", err
+	}
+	device := deviceCreateRequest{ProjectSSHKeys: []string{sshKeyID}}
+	device.DeviceCreateRequest = &packngo.DeviceCreateRequest{
 		HostName:     hostname,
 		OS:           string(os),
-		Tags:         []string{"integration-test"},
+		Tags:         provisionTags(clusterName, sshUser),
 		ProjectID:    c.ProjectID,
-		Plan:         "baremetal_0",
+		Plan:         string(hwPlan),
 		BillingCycle: "hourly",
 		Facility:     string(region),
+		UserData:     string(userData),
 	}
 	client := c.getAPIClient()
-	dev, _, err := client.Devices.Create(device)
+	req, err := client.NewRequest("POST", fmt.Sprintf("/projects/%s/devices", c.ProjectID), device)
 	if err != nil {
 		return "", err
 	}
+	dev := &packngo.Device{}
+	if _, err := client.Do(req, dev); err != nil {
+		return "", err
+	}
 	return dev.ID, nil
 }
 
+// userData returns the cloud-init user data of the node, which authorizes the client's SSH key for the kismatic user
+func (c Client) userData(hostname string) ([]byte, error) {
+	publicKey, err := c.loadOrCreatePublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return cloudinit.UserData(cloudinit.ForNode(cloudinit.Node{
+		Hostname:          hostname,
+		SSHAuthorizedKeys: []string{publicKey},
+	}))
+}
+
 func (c *Client) getAPIClient() *packngo.Client {
 	if c.apiClient != nil {
 		return c.apiClient
@@ -115,53 +159,66 @@ func (c Client) GetNode(deviceID string) (*plan.Node, error) {
 		Host:        dev.Hostname,
 		PublicIPv4:  getPublicIPv4(dev),
 		PrivateIPv4: getPrivateIPv4(dev),
-		SSHUser:     "root",
+		SSHUser:     sshUserForDevice(dev),
 	}
 	return node, nil
 }
 
 // GetSSHAccessibleNode blocks until the node is accessible via SSH and returns the node's information.
-func (c Client) GetSSHAccessibleNode(deviceID string, timeout time.Duration, sshKey string) (*plan.Node, error) {
-	timeoutChan := make(chan bool, 1)
-	go func() {
-		time.Sleep(timeout)
-		timeoutChan <- true
-	}()
+// It gives up when the context is cancelled or its deadline is exceeded.
+func (c Client) GetSSHAccessibleNode(ctx context.Context, deviceID string, sshKey string) (*plan.Node, error) {
 	// Loop until we get the node's public IP
 	var node *plan.Node
-	var err error
 	for {
-		select {
-		case <-timeoutChan:
-			return nil, fmt.Errorf("timed out waiting for node to be accessible")
-		default:
-			node, err = c.GetNode(deviceID)
-			if err != nil {
-				continue
-			}
-		}
-		if node.PublicIPv4 != "" {
+		n, err := c.GetNode(deviceID)
+		if err == nil && n.PublicIPv4 != "" {
+			node = n
 			break
 		}
-		fmt.Print(".")
-		time.Sleep(5 * time.Second)
+		if err := sleepContext(ctx, ipPollInterval); err != nil {
+			return nil, fmt.Errorf("timed out waiting for node to get a public IP: %v", err)
+		}
 	}
 	// Loop until ssh is accessible
 	for {
-		select {
-		case <-timeoutChan:
-			return nil, fmt.Errorf("timed out waiting for node to be accessible")
-		default:
-			if sshAccessible(node.PublicIPv4, sshKey, node.SSHUser) {
-				return node, nil
-			}
+		if sshAccessible(node.PublicIPv4, sshKey, node.SSHUser) {
+			return node, nil
+		}
+		if err := sleepContext(ctx, sshPollInterval); err != nil {
+			return nil, fmt.Errorf("timed out waiting for node to be accessible: %v", err)
 		}
-		fmt.Print(".")
-		time.Sleep(10 * time.Second)
 	}
 }
 
+// sleepContext pauses for the given duration, returning early with the context's error
+// if the context is done before the duration elapses.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// ListNodes returns all the nodes in the project, regardless of whether
+// they were provisioned with this tool.
 func (c Client) ListNodes() ([]plan.Node, error) {
+	return c.listNodes(func(packngo.Device) bool { return true })
+}
+
+// ListProvisionedNodes returns the nodes in the project that were provisioned
+// with this tool from this host. If clusterName is not empty, only the nodes
+// that belong to the given cluster are returned.
+func (c Client) ListProvisionedNodes(clusterName string) ([]plan.Node, error) {
+	return c.listNodes(func(d packngo.Device) bool {
+		return hasProvisionTags(d.Tags, clusterName)
+	})
+}
+
+func (c Client) listNodes(include func(packngo.Device) bool) ([]plan.Node, error) {
 	client := c.getAPIClient()
 	devices, _, err := client.Devices.List(c.ProjectID)
 	if err != nil {
@@ -169,12 +226,15 @@ func (c Client) ListNodes() ([]plan.Node, error) {
 	}
 	nodes := []plan.Node{}
 	for _, d := range devices {
+		if !include(d) {
+			continue
+		}
 		n := plan.Node{
 			ID:          d.ID,
 			Host:        d.Hostname,
 			PublicIPv4:  getPublicIPv4(&d),
 			PrivateIPv4: getPrivateIPv4(&d),
-			SSHUser:     "root",
+			SSHUser:     sshUserForDevice(&d),
 		}
 		nodes = append(nodes, n)
 	}
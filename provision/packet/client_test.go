@@ -3,6 +3,7 @@
 package packet
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -15,15 +16,21 @@ func TestClient(t *testing.T) {
 		t.Fatalf("failed to create client: %v", err)
 	}
 
+	sshKeyID, err := client.MaybeProvisionSSHKey()
+	if err != nil {
+		t.Fatalf("failed to provision SSH key: %v", err)
+	}
+
 	hostname := "testNode"
 	osImage := CentOS7
-	deviceID, err := client.CreateNode(hostname, osImage, USEast)
+	deviceID, err := client.CreateNode(hostname, osImage, "root", sshKeyID, "baremetal_0", USEast, "integration-test")
 	if err != nil {
 		t.Errorf("failed to create node: %v", err)
 	}
 	// Block until ssh is up
-	timeout := 10 * time.Minute
-	if _, err := client.GetSSHAccessibleNode(deviceID, timeout, os.Getenv("PACKET_SSH_KEY")); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if _, err := client.GetSSHAccessibleNode(ctx, deviceID, os.Getenv("PACKET_SSH_KEY")); err != nil {
 		t.Errorf("node did not become accessible")
 	}
 	// Delete node
@@ -9,7 +9,8 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/utils"
 
 	garbler "github.com/michaelbironneau/garbler/lib"
 	"github.com/spf13/cobra"
@@ -24,7 +25,10 @@ func createCmd() *cobra.Command {
 provision packet create -e 3 -m 2 -w 3
 
 # Create 1 etcd node, 1 master node and 1 worker node using CentOS 7
-provision packet create --useCentos`,
+provision packet create --os centos7
+
+# Create 1 etcd node, 1 master node and 1 worker node using RHEL 7 on a larger machine type
+provision packet create --os rhel7 --plan baremetal_2`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runCreate(opts)
 		},
@@ -32,14 +36,50 @@ provision packet create --useCentos`,
 	cmd.Flags().Uint16VarP(&opts.EtcdNodeCount, "etcdNodeCount", "e", 1, "Count of etcd nodes to produce.")
 	cmd.Flags().Uint16VarP(&opts.MasterNodeCount, "masterdNodeCount", "m", 1, "Count of master nodes to produce.")
 	cmd.Flags().Uint16VarP(&opts.WorkerNodeCount, "workerNodeCount", "w", 1, "Count of worker nodes to produce.")
-	cmd.Flags().BoolVar(&opts.CentOS, "useCentos", false, "If present, will install CentOS 7 rather than Ubuntu 16.04")
+	addOSFlags(cmd, opts)
 	cmd.Flags().BoolVarP(&opts.NoPlan, "noplan", "n", false, "If present, foregoes generating a plan file in this directory referencing the newly created nodes")
 	cmd.Flags().StringVar(&opts.Region, "region", "us-east", "The region to be used for provisioning machines. One of us-east|us-west|eu-west")
 	cmd.Flags().BoolVarP(&opts.Storage, "storage-cluster", "s", false, "Create a storage cluster from all Worker nodes.")
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster-name", "", "Name used to tag the machines of this cluster. Defaults to a name derived from the creation time.")
+	cmd.Flags().StringVar(&opts.HostnamePattern, "hostname-pattern", utils.DefaultHostnamePattern, "Pattern of the hostnames of the nodes. Must contain {role} and {index}, and may contain {cluster}")
 
 	return cmd
 }
 
+func addOSFlags(cmd *cobra.Command, opts *packetOpts) {
+	cmd.Flags().StringVar(&opts.OS, "os", "ubuntu1604", "The operating system to install. One of "+distroNames()+", or a Packet operating system slug")
+	cmd.Flags().StringVar(&opts.HardwarePlan, "plan", "", "The Packet machine type to provision. Defaults to the smallest type that supports the operating system")
+	cmd.Flags().StringVar(&opts.SSHUser, "ssh-user", "", "The user kismatic connects to the nodes as. Defaults to root, the only user that can log in on Packet's images")
+	cmd.Flags().BoolVar(&opts.CentOS, "useCentos", false, "If present, will install CentOS 7 rather than Ubuntu 16.04")
+	cmd.Flags().MarkDeprecated("useCentos", "use --os centos7 instead")
+}
+
+// selectDistro returns the distro and machine type selected in the options,
+// after validating that the operating system is available on Packet.
+func selectDistro(c *Client, opts *packetOpts) (distro, HardwarePlan, error) {
+	name := opts.OS
+	if opts.CentOS {
+		name = "centos7"
+	}
+	d, err := c.lookupDistro(name)
+	if err != nil {
+		return d, "", err
+	}
+	hwPlan := d.DefaultPlan
+	if opts.HardwarePlan != "" {
+		hwPlan = HardwarePlan(opts.HardwarePlan)
+	}
+	return d, hwPlan, nil
+}
+
+// sshUser returns the user kismatic connects to the nodes as
+func sshUser(opts *packetOpts) string {
+	if opts.SSHUser != "" {
+		return opts.SSHUser
+	}
+	return defaultSSHUser
+}
+
 func regionFromString(region string) (Region, error) {
 	switch region {
 	case "us-east":
@@ -59,13 +99,36 @@ func runCreate(opts *packetOpts) error {
 	if err != nil {
 		return err
 	}
+	sshKeyID, err := c.MaybeProvisionSSHKey()
+	if err != nil {
+		return err
+	}
 
-	distro := Ubuntu1604LTS
-	if opts.CentOS {
-		distro = CentOS7
+	distro, hwPlan, err := selectDistro(c, opts)
+	if err != nil {
+		return err
 	}
 	provTime := strconv.FormatInt(time.Now().Unix(), 10)
-	generateHostname := hostnameGenerator("kismatic", provTime)
+	if opts.ClusterName == "" {
+		opts.ClusterName = "kismatic-" + provTime
+	}
+	scheme, err := utils.NewHostnameScheme(opts.HostnamePattern, opts.ClusterName)
+	if err != nil {
+		return err
+	}
+	// Generate all hostnames before creating any node, so that an invalid pattern leaves nothing behind
+	etcdNames, err := scheme.Hostnames("etcd", int(opts.EtcdNodeCount))
+	if err != nil {
+		return err
+	}
+	masterNames, err := scheme.Hostnames("master", int(opts.MasterNodeCount))
+	if err != nil {
+		return err
+	}
+	workerNames, err := scheme.Hostnames("worker", int(opts.WorkerNodeCount))
+	if err != nil {
+		return err
+	}
 	nodeIDs := struct {
 		etcd   []string
 		master []string
@@ -77,26 +140,22 @@ func runCreate(opts *packetOpts) error {
 	}
 
 	fmt.Println("Provisioning nodes")
-	var i uint16
-	for i = 0; i < opts.EtcdNodeCount; i++ {
-		hostname := generateHostname("etcd", int(i))
-		nodeID, err := c.CreateNode(hostname, distro, region)
+	for _, hostname := range etcdNames {
+		nodeID, err := c.CreateNode(hostname, distro.OS, sshUser(opts), sshKeyID, hwPlan, region, opts.ClusterName)
 		if err != nil {
 			return err
 		}
 		nodeIDs.etcd = append(nodeIDs.etcd, nodeID)
 	}
-	for i = 0; i < opts.MasterNodeCount; i++ {
-		hostname := generateHostname("master", int(i))
-		nodeID, err := c.CreateNode(hostname, distro, region)
+	for _, hostname := range masterNames {
+		nodeID, err := c.CreateNode(hostname, distro.OS, sshUser(opts), sshKeyID, hwPlan, region, opts.ClusterName)
 		if err != nil {
 			return err
 		}
 		nodeIDs.master = append(nodeIDs.master, nodeID)
 	}
-	for i = 0; i < opts.WorkerNodeCount; i++ {
-		hostname := generateHostname("worker", int(i))
-		nodeID, err := c.CreateNode(hostname, distro, region)
+	for _, hostname := range workerNames {
+		nodeID, err := c.CreateNode(hostname, distro.OS, sshUser(opts), sshKeyID, hwPlan, region, opts.ClusterName)
 		if err != nil {
 			return err
 		}
@@ -104,34 +163,31 @@ func runCreate(opts *packetOpts) error {
 	}
 
 	fmt.Println("Waiting for nodes to be accessible via SSH. This takes a while...")
+	ctx, cancel := contextWithInterrupt(sshReadyTimeout)
+	defer cancel()
+	allIDs := []string{}
+	allIDs = append(allIDs, nodeIDs.etcd...)
+	allIDs = append(allIDs, nodeIDs.master...)
+	allIDs = append(allIDs, nodeIDs.worker...)
+	ready, err := c.WaitForSSHAccessibleNodes(ctx, allIDs, c.SSHKey, os.Stdout)
+	if err != nil {
+		return err
+	}
+	etcdCount := len(nodeIDs.etcd)
+	masterCount := len(nodeIDs.master)
 	nodes := struct {
 		etcd   []plan.Node
 		master []plan.Node
 		worker []plan.Node
-	}{}
-	for _, id := range nodeIDs.etcd {
-		node, err := c.GetSSHAccessibleNode(id, 15*time.Minute, c.SSHKey)
-		if err != nil {
-			return fmt.Errorf("error waiting for node to be ready")
-		}
-		nodes.etcd = append(nodes.etcd, *node)
-	}
-	for _, id := range nodeIDs.master {
-		node, err := c.GetSSHAccessibleNode(id, 15*time.Minute, c.SSHKey)
-		if err != nil {
-			return fmt.Errorf("error waiting for node to be ready")
-		}
-		nodes.master = append(nodes.master, *node)
-	}
-	for _, id := range nodeIDs.worker {
-		node, err := c.GetSSHAccessibleNode(id, 15*time.Minute, c.SSHKey)
-		if err != nil {
-			return fmt.Errorf("error waiting for node to be ready")
-		}
-		nodes.worker = append(nodes.worker, *node)
+	}{
+		etcd:   ready[:etcdCount],
+		master: ready[etcdCount : etcdCount+masterCount],
+		worker: ready[etcdCount+masterCount:],
 	}
 	fmt.Println()
 	fmt.Printf("Finished provisioning nodes on Packet.net in %s\n", time.Now().Sub(startTime))
+	fmt.Printf("The nodes are tagged with cluster name %q. To delete them, run:\n", opts.ClusterName)
+	fmt.Println("provision packet delete --cluster " + opts.ClusterName)
 
 	if opts.NoPlan {
 		fmt.Println("Etcd:")
@@ -222,9 +278,3 @@ func makeUniqueFile(count int) (*os.File, error) {
 func printNode(n plan.Node) {
 	fmt.Printf("  %v (Public: %v, Private: %v)\n", n.Host, n.PublicIPv4, n.PrivateIPv4)
 }
-
-func hostnameGenerator(nodePrefix, timestamp string) func(string, int) string {
-	return func(nodeType string, nodeIndex int) string {
-		return fmt.Sprintf("%s-%s-%d-%s", nodePrefix, nodeType, nodeIndex, timestamp)
-	}
-}
@@ -3,10 +3,11 @@ package packet
 import (
 	"fmt"
 	"html/template"
+	"os"
 	"strconv"
 	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/plan"
 	"github.com/spf13/cobra"
 )
 
@@ -19,10 +20,11 @@ func createMinikubeCmd() *cobra.Command {
 			return runCreateMinikube(opts)
 		},
 	}
-	cmd.Flags().BoolVar(&opts.CentOS, "useCentos", false, "If present, will install CentOS 7 rather than Ubuntu 16.04")
+	addOSFlags(cmd, opts)
 	cmd.Flags().BoolVarP(&opts.NoPlan, "noplan", "n", false, "If present, foregoes generating a plan file in this directory referencing the newly created nodes")
 	cmd.Flags().StringVar(&opts.Region, "region", "us-east", "The region to be used for provisioning machines. One of us-east|us-west|eu-west")
 	cmd.Flags().BoolVarP(&opts.Storage, "storage-cluster", "s", false, "Create a storage cluster from all Worker nodes.")
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster-name", "", "Name used to tag the machine of this cluster. Defaults to a name derived from the creation time.")
 
 	return cmd
 }
@@ -33,12 +35,19 @@ func runCreateMinikube(opts *packetOpts) error {
 	if err != nil {
 		return err
 	}
+	sshKeyID, err := c.MaybeProvisionSSHKey()
+	if err != nil {
+		return err
+	}
 
-	distro := Ubuntu1604LTS
-	if opts.CentOS {
-		distro = CentOS7
+	distro, hwPlan, err := selectDistro(c, opts)
+	if err != nil {
+		return err
 	}
 	provTime := strconv.FormatInt(time.Now().Unix(), 10)
+	if opts.ClusterName == "" {
+		opts.ClusterName = "kismatic-" + provTime
+	}
 	region, err := regionFromString(opts.Region)
 	if err != nil {
 		return err
@@ -46,19 +55,24 @@ func runCreateMinikube(opts *packetOpts) error {
 
 	fmt.Println("Provisioning node")
 	hostname := fmt.Sprintf("kismatic-node-%s", provTime)
-	nodeID, err := c.CreateNode(hostname, distro, region)
+	nodeID, err := c.CreateNode(hostname, distro.OS, sshUser(opts), sshKeyID, hwPlan, region, opts.ClusterName)
 	if err != nil {
 		return err
 	}
 
 	fmt.Println("Waiting for node to be accessible via SSH. This takes a while...")
-	node, err := c.GetSSHAccessibleNode(nodeID, 15*time.Minute, c.SSHKey)
+	ctx, cancel := contextWithInterrupt(sshReadyTimeout)
+	defer cancel()
+	ready, err := c.WaitForSSHAccessibleNodes(ctx, []string{nodeID}, c.SSHKey, os.Stdout)
 	if err != nil {
-		return fmt.Errorf("error waiting for node to be ready")
+		return err
 	}
+	node := &ready[0]
 
 	fmt.Println()
 	fmt.Printf("Finished provisioning nodes on Packet.net in %s\n", time.Now().Sub(startTime))
+	fmt.Printf("The node is tagged with cluster name %q. To delete it, run:\n", opts.ClusterName)
+	fmt.Println("provision packet delete --cluster " + opts.ClusterName)
 
 	if opts.NoPlan {
 		fmt.Println("")
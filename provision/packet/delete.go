@@ -4,11 +4,20 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/sashajeltuhin/ket/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/utils"
 	"github.com/spf13/cobra"
 )
 
+type deleteOpts struct {
+	All          bool
+	AllInProject bool
+	ClusterName  string
+	Yes          bool
+}
+
 func deleteCmd() *cobra.Command {
-	var deleteAll bool
+	opts := &deleteOpts{}
 	cmd := &cobra.Command{
 		Use:   "delete [HOSTNAME]",
 		Short: "Delete machines from the Packet.net project. This will destroy machines. Be ready.",
@@ -16,46 +25,102 @@ func deleteCmd() *cobra.Command {
 
 This command destroys machines on the project that is being managed with this tool.
 
-It will destroy machines in the project, regardless of whether the machines were provisioned with this tool.
+Only machines that were provisioned with this tool from this host are considered,
+unless the --all-in-project flag is used. In that case, it will destroy machines in
+the project, regardless of whether the machines were provisioned with this tool.
+
+You will be asked to confirm before any machine is destroyed, unless the --yes flag is used.
 
 Be ready.
 		`,
 		Example: `# Delete a specific machine in the project
 provision packet delete kismatic-master-0
 
-# Delete all machines in the project
-provision packet delete --all`,
+# Delete all machines that belong to a cluster
+provision packet delete --cluster kismatic-1496255432
+
+# Delete all machines provisioned with this tool from this host
+provision packet delete --all
+
+# Delete all machines in the project without asking for confirmation
+provision packet delete --all-in-project --yes`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return doDelete(cmd, args, deleteAll)
+			return doDelete(cmd, args, opts)
 		},
 	}
-	cmd.Flags().BoolVar(&deleteAll, "all", false, "Delete all machines in the project.")
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Delete all machines provisioned with this tool from this host.")
+	cmd.Flags().StringVar(&opts.ClusterName, "cluster", "", "Delete all machines that belong to the given cluster.")
+	cmd.Flags().BoolVar(&opts.AllInProject, "all-in-project", false, "Delete all machines in the project, regardless of whether they were provisioned with this tool.")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Do not ask for confirmation before deleting machines.")
 	return cmd
 }
 
-func doDelete(cmd *cobra.Command, args []string, deleteAll bool) error {
-	if !deleteAll && len(args) != 1 {
-		return errors.New("You must provide the hostname of the machine to be deleted, or use the --all flag to destroy all machines in the project")
+func doDelete(cmd *cobra.Command, args []string, opts *deleteOpts) error {
+	if opts.AllInProject && opts.ClusterName != "" {
+		return errors.New("The --cluster flag cannot be used together with the --all-in-project flag")
+	}
+	deleteMany := opts.All || opts.AllInProject || opts.ClusterName != ""
+	if !deleteMany && len(args) != 1 {
+		return errors.New("You must provide the hostname of the machine to be deleted, or use one of the --all, --cluster or --all-in-project flags")
+	}
+	if deleteMany && len(args) != 0 {
+		return errors.New("A hostname cannot be used together with the --all, --cluster or --all-in-project flags")
 	}
 	hostname := ""
-	if !deleteAll {
+	if !deleteMany {
 		hostname = args[0]
 	}
 	client, err := newFromEnv()
 	if err != nil {
 		return err
 	}
-	nodes, err := client.ListNodes()
+	var nodes []plan.Node
+	if opts.AllInProject {
+		nodes, err = client.ListNodes()
+	} else {
+		nodes, err = client.ListProvisionedNodes(opts.ClusterName)
+	}
 	if err != nil {
 		return err
 	}
+	toDelete := []plan.Node{}
 	for _, n := range nodes {
-		if hostname == n.Host || deleteAll {
-			if err := client.DeleteNode(n.ID); err != nil {
-				return err
-			}
-			fmt.Println("Deleted", n.Host)
+		if hostname == n.Host || deleteMany {
+			toDelete = append(toDelete, n)
+		}
+	}
+	if len(toDelete) == 0 {
+		fmt.Println("No machines to delete")
+		return nil
+	}
+
+	if !opts.Yes {
+		fmt.Println("The following machines will be destroyed:")
+		for _, n := range toDelete {
+			printNode(n)
+		}
+		if !utils.AskForConfirmation("Are you sure?") {
+			return errors.New("delete aborted")
+		}
+	}
+	deleted := map[string]bool{}
+	for _, n := range toDelete {
+		if err := client.DeleteNode(n.ID); err != nil {
+			return err
+		}
+		deleted[n.ID] = true
+		fmt.Println("Deleted", n.Host)
+	}
+	// Remove the project SSH key once there are no machines left that need it.
+	// Deleted machines might still be listed while they are being deprovisioned.
+	provisioned, err := client.ListProvisionedNodes("")
+	if err != nil {
+		return err
+	}
+	for _, n := range provisioned {
+		if !deleted[n.ID] {
+			return nil
 		}
 	}
-	return nil
+	return client.MaybeRemoveSSHKey()
 }
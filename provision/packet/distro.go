@@ -0,0 +1,101 @@
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+)
+
+// defaultSSHUser is the user kismatic connects as, unless --ssh-user is used. Packet's images of
+// every operating system, including the ones in the catalog, only allow root to log in.
+const defaultSSHUser = "root"
+
+// defaultHardwarePlan is the smallest machine type, which most operating systems are offered on
+const defaultHardwarePlan = HardwarePlan("baremetal_0")
+
+// distro describes the defaults used when provisioning an operating system on Packet
+type distro struct {
+	OS          OS
+	DefaultPlan HardwarePlan
+}
+
+// distros maps the names accepted by the --os flag to the operating systems we know how to provision
+var distros = map[string]distro{
+	"ubuntu1604": {OS: Ubuntu1604LTS, DefaultPlan: defaultHardwarePlan},
+	"ubuntu1804": {OS: Ubuntu1804LTS, DefaultPlan: defaultHardwarePlan},
+	"ubuntu2004": {OS: Ubuntu2004LTS, DefaultPlan: defaultHardwarePlan},
+	"centos7":    {OS: CentOS7, DefaultPlan: defaultHardwarePlan},
+	// RHEL is not offered on the smallest machine type
+	"rhel7": {OS: RHEL7, DefaultPlan: "baremetal_1"},
+	"rhel8": {OS: RHEL8, DefaultPlan: "baremetal_1"},
+}
+
+func distroNames() string {
+	names := []string{}
+	for n := range distros {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// distroFromString returns the catalog entry for the given name, which may also be the Packet
+// operating system slug of the entry. It returns false if the name is not in the catalog.
+func distroFromString(name string) (distro, bool) {
+	if d, ok := distros[name]; ok {
+		return d, true
+	}
+	for _, d := range distros {
+		if string(d.OS) == name {
+			return d, true
+		}
+	}
+	return distro{}, false
+}
+
+// lookupDistro returns the distro for the given name, after validating that its operating system
+// is offered by Packet. Names that are not in the catalog must be Packet operating system slugs.
+func (c Client) lookupDistro(name string) (distro, error) {
+	d, ok := distroFromString(name)
+	if !ok {
+		d = distro{OS: OS(name), DefaultPlan: defaultHardwarePlan}
+	}
+	if err := c.ValidateOS(d.OS); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// ValidateOS returns an error if the given operating system is not offered by Packet
+func (c Client) ValidateOS(os OS) error {
+	client := c.getAPIClient()
+	available, _, err := client.OperatingSystems.List()
+	if err != nil {
+		return fmt.Errorf("error listing operating systems: %v", err)
+	}
+	if !offered(available, os) {
+		return fmt.Errorf("operating system %q is not available on Packet. Use one of %s, or a Packet operating system slug", os, distroNames())
+	}
+	return nil
+}
+
+// offered returns true if the operating system is in the list of operating systems offered by Packet
+func offered(available []packngo.OS, os OS) bool {
+	for _, o := range available {
+		if o.Slug == string(os) {
+			return true
+		}
+	}
+	return false
+}
+
+// sshUserForDevice returns the user that can SSH into the device: the user it was tagged with
+// when it was created, or the default user of Packet's images
+func sshUserForDevice(dev *packngo.Device) string {
+	if user := tagValue(dev.Tags, sshUserTagPrefix); user != "" {
+		return user
+	}
+	return defaultSSHUser
+}
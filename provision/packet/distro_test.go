@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/packethost/packngo"
+)
+
+func TestDistroFromString(t *testing.T) {
+	if d, ok := distroFromString("rhel7"); !ok || d.OS != RHEL7 || d.DefaultPlan != "baremetal_1" {
+		t.Errorf("unexpected distro for rhel7: %+v", d)
+	}
+	if d, ok := distroFromString(string(CentOS7)); !ok || d.OS != CentOS7 {
+		t.Errorf("expected the catalog entry of slug %q, got %+v", CentOS7, d)
+	}
+	if _, ok := distroFromString("debian_9"); ok {
+		t.Errorf("expected slug debian_9 not to be in the catalog")
+	}
+}
+
+func TestOffered(t *testing.T) {
+	available := []packngo.OS{{Slug: string(Ubuntu1604LTS)}, {Slug: "debian_9"}}
+	tests := []struct {
+		os       OS
+		expected bool
+	}{
+		{Ubuntu1604LTS, true},
+		{"debian_9", true},
+		{RHEL8, false},
+		{"not_an_os", false},
+	}
+	for _, test := range tests {
+		if got := offered(available, test.os); got != test.expected {
+			t.Errorf("expected offered(%q) to be %v, got %v", test.os, test.expected, got)
+		}
+	}
+}
+
+func TestSSHUserForDevice(t *testing.T) {
+	tests := []struct {
+		dev      packngo.Device
+		expected string
+	}{
+		{packngo.Device{Tags: provisionTags("kismatic-1", "kismaticuser"), OS: &packngo.OS{Slug: string(Ubuntu1604LTS)}}, "kismaticuser"},
+		{packngo.Device{OS: &packngo.OS{Slug: string(Ubuntu1604LTS)}}, defaultSSHUser},
+		{packngo.Device{}, defaultSSHUser},
+	}
+	for _, test := range tests {
+		if user := sshUserForDevice(&test.dev); user != test.expected {
+			t.Errorf("expected SSH user %q, got %q", test.expected, user)
+		}
+	}
+}
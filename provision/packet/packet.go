@@ -7,9 +7,14 @@ type packetOpts struct {
 	MasterNodeCount uint16
 	WorkerNodeCount uint16
 	CentOS          bool
+	OS              string
+	HardwarePlan    string
+	SSHUser         string
 	NoPlan          bool
 	Region          string
 	Storage         bool
+	ClusterName     string
+	HostnamePattern string
 }
 
 // Cmd returns the command for managing Packet infrastructure
@@ -27,7 +32,9 @@ Required:
 Optional:
   PACKET_SSH_KEY_PATH: The path to the SSH key to be used for accessing the machines.
     If empty, a file called "kismatic-packet.pem" in the current working directory is
-    used as the SSH key.
+    used as the SSH key. If the key does not exist, it is generated. The public key is
+    registered as a project SSH key when machines are created, and removed from the
+    project once all the machines provisioned from this host are deleted.
 `,
 	}
 	cmd.AddCommand(createCmd())
@@ -5,7 +5,7 @@ import (
 	"io"
 	"text/tabwriter"
 
-	"github.com/apprenda/kismatic-provision/provision/plan"
+	"github.com/sashajeltuhin/ket/provision/plan"
 )
 
 func printNodes(out io.Writer, nodes []plan.Node) {
@@ -0,0 +1,119 @@
+package packet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/packethost/packngo"
+	"github.com/sashajeltuhin/ket/provision/utils"
+)
+
+// sshKeyLabel returns the label of the project SSH key that is managed by this tool on this host
+func sshKeyLabel() string {
+	thisHost, _ := os.Hostname()
+	return "kismatic-provision-" + thisHost
+}
+
+// createdKeyFile returns the file that records the ID of the project SSH key this tool registered
+// for the client's SSH key. Only that key is removed at teardown.
+func (c *Client) createdKeyFile() string {
+	return c.SSHKey + ".packet-key-id"
+}
+
+// MaybeProvisionSSHKey makes sure that the client's SSH key can be used to access new devices, and
+// returns the ID of its project SSH key, which is attached to the devices when they are created.
+// If the private key does not exist, a new one is generated. The public key is then registered
+// as a project SSH key, unless the project already has it. A key registered here is recorded, so
+// that it is removed at teardown. Keys that were already in the project are left alone.
+func (c *Client) MaybeProvisionSSHKey() (string, error) {
+	publicKey, err := c.loadOrCreatePublicKey()
+	if err != nil {
+		return "", err
+	}
+	client := c.getAPIClient()
+	keys, _, err := client.SSHKeys.ProjectList(c.ProjectID)
+	if err != nil {
+		return "", fmt.Errorf("error listing project SSH keys: %v", err)
+	}
+	for _, k := range keys {
+		if sameAuthorizedKey(k.Key, publicKey) {
+			fmt.Printf("Found SSH key %q in project\n", k.Label)
+			return k.ID, nil
+		}
+	}
+
+	fmt.Printf("Registering new SSH key %q in project\n", sshKeyLabel())
+	req := &packngo.SSHKeyCreateRequest{
+		Label:     sshKeyLabel(),
+		Key:       publicKey,
+		ProjectID: c.ProjectID,
+	}
+	key, _, err := client.SSHKeys.Create(req)
+	if err != nil {
+		return "", fmt.Errorf("error registering SSH key in project: %v", err)
+	}
+	if err := ioutil.WriteFile(c.createdKeyFile(), []byte(key.ID), 0600); err != nil {
+		return "", fmt.Errorf("error recording SSH key %q: %v", key.Label, err)
+	}
+	return key.ID, nil
+}
+
+// MaybeRemoveSSHKey removes the project SSH key if it was registered by MaybeProvisionSSHKey
+func (c *Client) MaybeRemoveSSHKey() error {
+	keyID, err := ioutil.ReadFile(c.createdKeyFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", c.createdKeyFile(), err)
+	}
+	id := strings.TrimSpace(string(keyID))
+	client := c.getAPIClient()
+	resp, err := client.SSHKeys.Delete(id)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("error removing SSH key %q from project: %v", id, err)
+	}
+	fmt.Printf("Removed SSH key %q from project\n", sshKeyLabel())
+	return os.Remove(c.createdKeyFile())
+}
+
+// loadOrCreatePublicKey returns the public key of the client's SSH key in authorized_keys format.
+// The private key is generated if it does not exist, and the public key is written next to it.
+func (c *Client) loadOrCreatePublicKey() (string, error) {
+	publicKeyPath := c.SSHKey + ".pub"
+	_, privErr := os.Stat(c.SSHKey)
+	_, pubErr := os.Stat(publicKeyPath)
+	if privErr != nil || pubErr != nil {
+		if os.IsNotExist(privErr) {
+			fmt.Printf("Generating new SSH key %s\n", c.SSHKey)
+		}
+		privateKey, err := utils.LoadOrCreatePrivateSSHKey(c.SSHKey)
+		if err != nil {
+			return "", fmt.Errorf("error loading SSH key %q: %v", c.SSHKey, err)
+		}
+		if err := utils.CreatePublicKey(privateKey, publicKeyPath); err != nil {
+			return "", fmt.Errorf("error writing public SSH key %q: %v", publicKeyPath, err)
+		}
+		// ensure correct permissions
+		os.Chmod(c.SSHKey, 0600)
+	}
+	pub, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading public SSH key %q: %v", publicKeyPath, err)
+	}
+	return strings.TrimSpace(string(pub)), nil
+}
+
+// sameAuthorizedKey returns true if both keys have the same type and key material,
+// ignoring the comment.
+func sameAuthorizedKey(a, b string) bool {
+	fa := strings.Fields(a)
+	fb := strings.Fields(b)
+	if len(fa) < 2 || len(fb) < 2 {
+		return false
+	}
+	return fa[0] == fb[0] && fa[1] == fb[1]
+}
@@ -0,0 +1,55 @@
+package packet
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	provisionedByTag   = "provisioned-by:kismatic"
+	createdByTagPrefix = "created-by:"
+	clusterTagPrefix   = "cluster:"
+	sshUserTagPrefix   = "ssh-user:"
+)
+
+// provisionTags returns the tags that identify a device as provisioned by this tool,
+// from this host, for the given cluster, and the user that can SSH into it.
+func provisionTags(clusterName string, sshUser string) []string {
+	thisHost, _ := os.Hostname()
+	return []string{
+		provisionedByTag,
+		createdByTagPrefix + thisHost,
+		clusterTagPrefix + clusterName,
+		sshUserTagPrefix + sshUser,
+	}
+}
+
+// tagValue returns the value of the first tag with the given prefix, or an empty string
+func tagValue(tags []string, prefix string) string {
+	for _, t := range tags {
+		if strings.HasPrefix(t, prefix) {
+			return strings.TrimPrefix(t, prefix)
+		}
+	}
+	return ""
+}
+
+// hasProvisionTags returns true if the tags identify a device that was provisioned
+// by this tool from this host. If clusterName is not empty, the device must also
+// belong to the given cluster.
+func hasProvisionTags(tags []string, clusterName string) bool {
+	thisHost, _ := os.Hostname()
+	var provisioned, createdHere bool
+	inCluster := clusterName == ""
+	for _, t := range tags {
+		switch {
+		case t == provisionedByTag:
+			provisioned = true
+		case t == createdByTagPrefix+thisHost:
+			createdHere = true
+		case t == clusterTagPrefix+clusterName:
+			inCluster = true
+		}
+	}
+	return provisioned && createdHere && inCluster
+}
@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProvisionTags(t *testing.T) {
+	thisHost, _ := os.Hostname()
+	tags := provisionTags("kismatic-1", "root")
+	expected := []string{"provisioned-by:kismatic", "created-by:" + thisHost, "cluster:kismatic-1", "ssh-user:root"}
+	if len(tags) != len(expected) {
+		t.Fatalf("expected tags %v, got %v", expected, tags)
+	}
+	for i := range expected {
+		if tags[i] != expected[i] {
+			t.Errorf("expected tag %q, got %q", expected[i], tags[i])
+		}
+	}
+}
+
+func TestHasProvisionTags(t *testing.T) {
+	thisHost, _ := os.Hostname()
+	tests := []struct {
+		name        string
+		tags        []string
+		clusterName string
+		expected    bool
+	}{
+		{"provisioned here, any cluster", provisionTags("kismatic-1", "root"), "", true},
+		{"provisioned here, same cluster", provisionTags("kismatic-1", "root"), "kismatic-1", true},
+		{"provisioned here, other cluster", provisionTags("kismatic-1", "root"), "kismatic-2", false},
+		{"no tags", nil, "", false},
+		{"not provisioned by the tool", []string{"created-by:" + thisHost, "cluster:kismatic-1"}, "", false},
+		{"provisioned on another host", []string{"provisioned-by:kismatic", "created-by:" + thisHost + "-other", "cluster:kismatic-1"}, "", false},
+		{"cluster tag prefix only", []string{"provisioned-by:kismatic", "created-by:" + thisHost, "cluster:kismatic-10"}, "kismatic-1", false},
+	}
+	for _, test := range tests {
+		if got := hasProvisionTags(test.tags, test.clusterName); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestTagValue(t *testing.T) {
+	tags := provisionTags("kismatic-1", "kismaticuser")
+	if v := tagValue(tags, sshUserTagPrefix); v != "kismaticuser" {
+		t.Errorf("expected SSH user %q, got %q", "kismaticuser", v)
+	}
+	if v := tagValue([]string{"provisioned-by:kismatic"}, sshUserTagPrefix); v != "" {
+		t.Errorf("expected no SSH user, got %q", v)
+	}
+}
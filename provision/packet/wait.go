@@ -0,0 +1,77 @@
+package packet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sashajeltuhin/ket/provision/plan"
+)
+
+const (
+	// sshReadyTimeout is the overall time we are willing to wait for all nodes to become accessible
+	sshReadyTimeout = 30 * time.Minute
+	// ipPollInterval is the time between attempts to get the node's public IP
+	ipPollInterval = 5 * time.Second
+	// sshPollInterval is the time between attempts to connect to the node via SSH
+	sshPollInterval = 10 * time.Second
+)
+
+// contextWithInterrupt returns a context that is cancelled when the timeout expires,
+// or when the process receives an interrupt or termination signal.
+func contextWithInterrupt(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			fmt.Println()
+			fmt.Println("Interrupted. Cancelling...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
+type nodeResult struct {
+	index int
+	node  *plan.Node
+	err   error
+}
+
+// WaitForSSHAccessibleNodes blocks until all the given devices are accessible via SSH,
+// or until the context is done. Devices are polled concurrently, and a progress message
+// is written to out as each node becomes ready. The returned nodes are in the same
+// order as the given device IDs.
+func (c Client) WaitForSSHAccessibleNodes(ctx context.Context, deviceIDs []string, sshKey string, out io.Writer) ([]plan.Node, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan nodeResult, len(deviceIDs))
+	for i, id := range deviceIDs {
+		go func(index int, deviceID string) {
+			node, err := c.GetSSHAccessibleNode(ctx, deviceID, sshKey)
+			results <- nodeResult{index: index, node: node, err: err}
+		}(i, id)
+	}
+
+	nodes := make([]plan.Node, len(deviceIDs))
+	for ready := 0; ready < len(deviceIDs); ready++ {
+		res := <-results
+		if res.err != nil {
+			// stop waiting on the other nodes
+			return nil, fmt.Errorf("error waiting for node %q to be ready: %v", deviceIDs[res.index], res.err)
+		}
+		nodes[res.index] = *res.node
+		fmt.Fprintf(out, "  %s is accessible via SSH (%d/%d, %s elapsed)\n", res.node.Host, ready+1, len(deviceIDs), time.Since(start).Round(time.Second))
+	}
+	return nodes, nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultHostnamePattern names nodes after their cluster, role and index, e.g. kismatic-1496255432-worker-0
+const DefaultHostnamePattern = "{cluster}-{role}-{index}"
+
+// maxHostnameLength is the longest DNS label
+const maxHostnameLength = 63
+
+// HostnameScheme generates the hostnames of the nodes of a cluster from a pattern.
+// The pattern may contain the {cluster}, {role} and {index} placeholders. {role} and {index}
+// are required, so that the nodes of a cluster never share a hostname. Hostnames are DNS labels:
+// they are lowercased, and characters other than letters, digits and '-' are replaced by '-'.
+type HostnameScheme struct {
+	Pattern string
+	Cluster string
+}
+
+// NewHostnameScheme returns the scheme of the given pattern, or of the default pattern if empty
+func NewHostnameScheme(pattern string, cluster string) (HostnameScheme, error) {
+	if pattern == "" {
+		pattern = DefaultHostnamePattern
+	}
+	if !strings.Contains(pattern, "{role}") || !strings.Contains(pattern, "{index}") {
+		return HostnameScheme{}, fmt.Errorf("invalid hostname pattern %q: it must contain {role} and {index}", pattern)
+	}
+	return HostnameScheme{Pattern: pattern, Cluster: cluster}, nil
+}
+
+// Hostname returns the hostname of the node of the role with the given index
+func (s HostnameScheme) Hostname(role string, index int) (string, error) {
+	r := strings.NewReplacer("{cluster}", s.Cluster, "{role}", role, "{index}", strconv.Itoa(index))
+	name := DNSLabel(r.Replace(s.Pattern))
+	if name == "" {
+		return "", fmt.Errorf("hostname pattern %q yields an empty hostname for %s node %d", s.Pattern, role, index)
+	}
+	if len(name) > maxHostnameLength {
+		return "", fmt.Errorf("hostname %q is longer than %d characters. Use a shorter cluster name or hostname pattern", name, maxHostnameLength)
+	}
+	return name, nil
+}
+
+// Hostnames returns the hostnames of count nodes of the role
+func (s HostnameScheme) Hostnames(role string, count int) ([]string, error) {
+	names := []string{}
+	for i := 0; i < count; i++ {
+		name, err := s.Hostname(role, i)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// DNSLabel lowercases s and replaces every run of characters that are not allowed in a DNS label
+// with a single '-'. Leading and trailing dashes are removed.
+func DNSLabel(s string) string {
+	label := make([]byte, 0, len(s))
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			label = append(label, byte(c))
+			dash = false
+			continue
+		}
+		if !dash {
+			label = append(label, '-')
+			dash = true
+		}
+	}
+	return strings.Trim(string(label), "-")
+}
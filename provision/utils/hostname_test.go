@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostnameScheme(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		cluster  string
+		role     string
+		index    int
+		expected string
+	}{
+		{"", "kismatic-1496255432", "worker", 10, "kismatic-1496255432-worker-10"},
+		{"{role}{index}.{cluster}", "prod", "etcd", 2, "etcd2-prod"},
+		{"{cluster}-{role}-{index}", "My_Cluster", "Master", 0, "my-cluster-master-0"},
+		{"--{role}__{index}--", "", "worker", 1, "worker-1"},
+	}
+	for _, test := range tests {
+		s, err := NewHostnameScheme(test.pattern, test.cluster)
+		if err != nil {
+			t.Errorf("unexpected error for pattern %q: %v", test.pattern, err)
+			continue
+		}
+		name, err := s.Hostname(test.role, test.index)
+		if err != nil {
+			t.Errorf("unexpected error for pattern %q: %v", test.pattern, err)
+			continue
+		}
+		if name != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, name)
+		}
+	}
+}
+
+func TestHostnameSchemeErrors(t *testing.T) {
+	for _, pattern := range []string{"{cluster}-{role}", "{cluster}-{index}", "node"} {
+		if _, err := NewHostnameScheme(pattern, "kismatic"); err == nil {
+			t.Errorf("expected an error for pattern %q", pattern)
+		}
+	}
+	s, err := NewHostnameScheme("", strings.Repeat("a", 60))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Hostname("worker", 0); err == nil {
+		t.Errorf("expected an error for a hostname longer than 63 characters")
+	}
+}
+
+func TestHostnamesAreUnique(t *testing.T) {
+	s, err := NewHostnameScheme("", "kismatic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, role := range []string{"etcd", "master", "worker"} {
+		names, err := s.Hostnames(role, 12)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, n := range names {
+			if seen[n] {
+				t.Errorf("hostname %q generated twice", n)
+			}
+			seen[n] = true
+		}
+	}
+}
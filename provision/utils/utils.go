@@ -9,14 +9,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 
-	garbler "github.com/michaelbironneau/garbler/lib"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -92,31 +89,6 @@ func MakeUniqueFile(name string, suffix string, count int) (*os.File, error) {
 	}
 }
 
-func GenerateAlphaNumericPassword() string {
-	attempts := 0
-	for {
-		reqs := &garbler.PasswordStrengthRequirements{
-			MinimumTotalLength: 16,
-			Uppercase:          rand.Intn(6),
-			Digits:             rand.Intn(6),
-			Punctuation:        -1, // disable punctuation
-		}
-		pass, err := garbler.NewPassword(reqs)
-		if err != nil {
-			return "weakpassword"
-		}
-		// validate that the library actually returned an alphanumeric password
-		re := regexp.MustCompile("^[a-zA-Z1-9]+$")
-		if re.MatchString(pass) {
-			return pass
-		}
-		if attempts == 50 {
-			return "weakpassword"
-		}
-		attempts++
-	}
-}
-
 func IncrementIPv4(ip net.IP) (net.IP, error) {
 
 	if len(ip) != net.IPv4len {
@@ -195,6 +167,19 @@ func LoadOrCreatePrivateSSHKey(privateKeyPath string) (*rsa.PrivateKey, error) {
 	}
 }
 
+// LoadPublicSSHKey returns the public key of the PEM encoded private key in authorized_keys format
+func LoadPublicSSHKey(privateKeyPath string) (string, error) {
+	buffer, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return "", err
+	}
+	signer, err := ssh.ParsePrivateKey(buffer)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
 func CreatePublicKey(privateKey *rsa.PrivateKey, publicKeyPath string) error {
 	// generate and write public key
 	pub, err := ssh.NewPublicKey(&privateKey.PublicKey)
@@ -0,0 +1,155 @@
+package vagrant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultOS is the operating system installed when none is selected
+const defaultOS = "ubuntu1604"
+
+// osBoxes are the vagrant boxes that provide an operating system
+type osBoxes struct {
+	Redhat bool
+	// Boxes maps a vagrant provider to the box that supports it. The empty provider is the default box.
+	Boxes map[string]string
+}
+
+var osCatalog = map[string]osBoxes{
+	"ubuntu1604": {
+		Boxes: map[string]string{"": "bento/ubuntu-16.04", "libvirt": "generic/ubuntu1604"},
+	},
+	"ubuntu1804": {
+		Boxes: map[string]string{"": "bento/ubuntu-18.04", "libvirt": "generic/ubuntu1804"},
+	},
+	"centos7": {
+		Redhat: true,
+		Boxes:  map[string]string{"": "bento/centos-7.3", "libvirt": "generic/centos7"},
+	},
+	"rhel7": {
+		Redhat: true,
+		Boxes:  map[string]string{"": "generic/rhel7", "libvirt": "generic/rhel7"},
+	},
+}
+
+func osNames() string {
+	names := []string{}
+	for n := range osCatalog {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// selectOS sets the operating system in the options to the default if none was selected.
+// The deprecated --useCentOS flag, which sets the Redhat option, selects centos7.
+func selectOS(opts *InfrastructureOpts) error {
+	if opts.Redhat {
+		if opts.OS != "" && opts.OS != "centos7" {
+			return fmt.Errorf("--useCentOS cannot be used together with --os %s", opts.OS)
+		}
+		opts.OS = "centos7"
+	}
+	if opts.OS == "" {
+		opts.OS = defaultOS
+	}
+	return nil
+}
+
+// selectBox sets the Redhat option from the operating system in the options, and the box
+// unless one was explicitly provided.
+func selectBox(opts *InfrastructureOpts) error {
+	distro, ok := osCatalog[opts.OS]
+	if !ok {
+		return fmt.Errorf("unsupported operating system %q. One of %s", opts.OS, osNames())
+	}
+	opts.Redhat = distro.Redhat
+	if opts.Box != "" {
+		return nil
+	}
+	box, ok := distro.Boxes[opts.Provider]
+	if !ok {
+		box = distro.Boxes[""]
+	}
+	opts.Box = box
+	return nil
+}
+
+// InstalledBox is a box that has been downloaded by vagrant
+type InstalledBox struct {
+	Name     string
+	Provider string
+	Version  string
+}
+
+// BoxList returns the boxes that have been downloaded by vagrant
+func (c Client) BoxList() ([]InstalledBox, error) {
+	cmd := c.command("box", "list", "--machine-readable")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error listing vagrant boxes: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseMachineReadableBoxList(out), nil
+}
+
+// parseMachineReadableBoxList parses the output of `vagrant box list --machine-readable`,
+// where every box is described by a box-name line followed by box-provider and box-version lines.
+func parseMachineReadableBoxList(out []byte) []InstalledBox {
+	boxes := []InstalledBox{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 4 {
+			continue
+		}
+		dataType, data := fields[2], strings.Join(fields[3:], ",")
+		if dataType == "box-name" {
+			boxes = append(boxes, InstalledBox{Name: data})
+			continue
+		}
+		if len(boxes) == 0 {
+			continue
+		}
+		switch dataType {
+		case "box-provider":
+			boxes[len(boxes)-1].Provider = data
+		case "box-version":
+			boxes[len(boxes)-1].Version = data
+		}
+	}
+	return boxes
+}
+
+// checkBoxInstalled returns an error if the box in the options has not been downloaded by vagrant.
+// An empty provider or version matches any installed provider or version.
+func checkBoxInstalled(client Client, opts *InfrastructureOpts) error {
+	boxes, err := client.BoxList()
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		if b.Name != opts.Box {
+			continue
+		}
+		if opts.Provider != "" && b.Provider != opts.Provider {
+			continue
+		}
+		if opts.BoxVersion != "" && b.Version != opts.BoxVersion {
+			continue
+		}
+		return nil
+	}
+	add := "vagrant box add " + opts.Box
+	if opts.Provider != "" {
+		add += " --provider " + opts.Provider
+	}
+	if opts.BoxVersion != "" {
+		add += " --box-version " + opts.BoxVersion
+	}
+	return fmt.Errorf("box %q is not installed. While online, run '%s' to download it", opts.Box, add)
+}
@@ -0,0 +1,80 @@
+package vagrant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMachineReadableBoxList(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		expected []InstalledBox
+	}{
+		{
+			name:     "no boxes",
+			out:      "1496255432,,ui,info,There are no installed boxes! Use `vagrant box add` to add some.\n",
+			expected: []InstalledBox{},
+		},
+		{
+			name: "several boxes",
+			out: `1496255432,,box-name,bento/ubuntu-16.04
+1496255432,,box-provider,virtualbox
+1496255432,,box-version,2.3.5
+1496255432,,box-name,generic/centos7
+1496255432,,box-provider,libvirt
+1496255432,,box-version,1.9.2
+`,
+			expected: []InstalledBox{
+				{Name: "bento/ubuntu-16.04", Provider: "virtualbox", Version: "2.3.5"},
+				{Name: "generic/centos7", Provider: "libvirt", Version: "1.9.2"},
+			},
+		},
+		{
+			name: "details before any box and malformed lines",
+			out: `1496255432,,box-provider,virtualbox
+garbage
+1496255432,,box-name,bento/centos-7.3
+1496255432,,box-version
+`,
+			expected: []InstalledBox{{Name: "bento/centos-7.3"}},
+		},
+	}
+	for _, test := range tests {
+		boxes := parseMachineReadableBoxList([]byte(test.out))
+		if !reflect.DeepEqual(boxes, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, boxes)
+		}
+	}
+}
+
+func TestSelectOS(t *testing.T) {
+	tests := []struct {
+		os       string
+		redhat   bool
+		expected string
+		err      bool
+	}{
+		{"", false, defaultOS, false},
+		{"rhel7", false, "rhel7", false},
+		{"", true, "centos7", false},
+		{"centos7", true, "centos7", false},
+		{"ubuntu1804", true, "", true},
+	}
+	for _, test := range tests {
+		opts := &InfrastructureOpts{OS: test.os, Redhat: test.redhat}
+		err := selectOS(opts)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected an error for --os %q with --useCentOS", test.os)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for --os %q: %v", test.os, err)
+		}
+		if opts.OS != test.expected {
+			t.Errorf("expected OS %q, got %q", test.expected, opts.OS)
+		}
+	}
+}
@@ -2,15 +2,22 @@ package vagrant
 
 import (
 	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
 
-	"github.com/apprenda/kismatic-provision/provision/utils"
+	garbler "github.com/michaelbironneau/garbler/lib"
 	"github.com/spf13/cobra"
 )
 
 type VagrantCmdOpts struct {
 	PlanOpts
+	ClusterName             string
 	NoPlan                  bool
 	OnlyGenerateVagrantfile bool
+	Offline                 bool
 }
 
 func Cmd() *cobra.Command {
@@ -22,18 +29,28 @@ func Cmd() *cobra.Command {
 
 	cmd.AddCommand(VagrantCreateCmd())
 	cmd.AddCommand(VagrantCreateMinikubeCmd())
+	cmd.AddCommand(VagrantStatusCmd())
+	cmd.AddCommand(VagrantHaltCmd())
+	cmd.AddCommand(VagrantResumeCmd())
+	cmd.AddCommand(VagrantDestroyCmd())
 
 	return cmd
 }
 
 func AddSharedFlags(cmd *cobra.Command, opts *VagrantCmdOpts) {
 	//InfrastructureOps
-	//(*cmd).Flags().StringVarP(&opts.NodeCIDR, "nodeCIDR", "c", "192.168.205.0/24", "Network CIDR to use in creating the VM Nodes")
-	opts.NodeCIDR = "192.168.42.2/24"
+	(*cmd).Flags().StringVarP(&opts.NodeCIDR, "nodeCIDR", "c", "192.168.42.0/24", "Network CIDR to use in creating the VM Nodes. The first address is reserved for the gateway.")
+	(*cmd).Flags().StringVar(&opts.OS, "os", "", "The operating system to install. One of "+osNames()+". Defaults to "+defaultOS)
+	(*cmd).Flags().StringVar(&opts.Box, "box", "", "The vagrant box to use. Defaults to a box of the operating system that supports the vagrant provider")
+	(*cmd).Flags().StringVar(&opts.BoxVersion, "box-version", "", "The version of the vagrant box to use. If empty, the latest installed version is used")
+	(*cmd).Flags().BoolVar(&opts.Offline, "offline", false, "If present, fails early if the vagrant box has not been downloaded already")
 	(*cmd).Flags().BoolVarP(&opts.Redhat, "useCentOS", "r", false, "If present, will install CentOS 7.3 rather than Ubuntu 16.04")
+	(*cmd).Flags().MarkDeprecated("useCentOS", "use --os centos7 instead")
+	(*cmd).Flags().StringVar(&opts.ManagementCIDR, "libvirt-management-cidr", "192.168.121.0/24", "Network CIDR of the DHCP management network that libvirt uses to reach the VMs. It cannot be the node CIDR: vagrant reaches the VMs through the DHCP addresses of the management network, while the nodes have static addresses on the node network, and libvirt does not allow two networks with the same addresses. Clusters that use the same management CIDR share the management network")
+	(*cmd).Flags().StringVar(&opts.Provider, "vagrant-provider", "", "The vagrant provider used to create the VMs. One of virtualbox|vmware_fusion|libvirt. If empty, vagrant chooses the default provider")
 	// (*cmd).Flags().StringVarP(&opts.PrivateSSHKeyPath, "keypath", "k", "", "Path to private SSH key to use in provisioning VMs.")
 	//(*cmd).Flags().StringVarP(&opts.Vagrantfile, "vagrantfile", "f", "Vagrantfile", "Path to Vagrantfile to generate")
-	opts.Vagrantfile = "Vagrantfile"
+	(*cmd).Flags().StringVar(&opts.ClusterName, "name", defaultClusterName, "Name of the cluster, a DNS label. The cluster's Vagrantfile and plan file are generated in "+filepath.Join(clustersDir, "<name>"))
 
 	//PlanOpts
 	// (*cmd).Flags().BoolVar(&opts.AllowPackageInstallation, "allowPackageInstallation", true, "If true, allows os packages to be installed automatically")
@@ -43,25 +60,29 @@ func AddSharedFlags(cmd *cobra.Command, opts *VagrantCmdOpts) {
 	// (*cmd).Flags().StringVar(&opts.DockerRegistryHost, "dockerRegistryIP", "", "IP or hostname for your Docker registry. An internal registry will NOT be setup when this field is provided. Must be accessible from all the nodes in the cluster.")
 	// (*cmd).Flags().Uint16Var(&opts.DockerRegistryPort, "dockerRegistryPort", 443, "Port for your Docker registry")
 	// (*cmd).Flags().StringVar(&opts.DockerRegistryCAPath, "dockerRegistryCAPath", "", "Absolute path to the CA that was used when starting your Docker registry. The docker daemons on all nodes in the cluster will be configured with this CA.")
-	(*cmd).Flags().StringVar(&opts.AdminPassword, "adminPassword", utils.GenerateAlphaNumericPassword(), "This password is used to login to the Kubernetes Dashboard and can also be used for administration without a security certificate")
-	opts.AdminPassword = utils.GenerateAlphaNumericPassword()
+	(*cmd).Flags().StringVar(&opts.AdminPassword, "adminPassword", generateAlphaNumericPassword(), "This password is used to login to the Kubernetes Dashboard and can also be used for administration without a security certificate")
+	opts.AdminPassword = generateAlphaNumericPassword()
 	// (*cmd).Flags().StringVar(&opts.PodCIDR, "podCIDR", "172.16.0.0/16", "Kubernetes will assign pods IPs in this range. Do not use a range that is already in use on your local network!")
 	opts.PodCIDR = "172.16.0.0/16"
 	// (*cmd).Flags().StringVar(&opts.ServiceCIDR, "serviceCIDR", "172.17.0.0/16", "Kubernetes will assign services IPs in this range. Do not use a range that is already in use by your local network or pod network!")
 	opts.ServiceCIDR = "172.17.0.0/16"
 	// VagrantCmdOpts
 	// (*cmd).Flags().BoolVar(&opts.OnlyGenerateVagrantfile, "onlyGenerateVagrantFile", false, "If present, forgoes performing `vagrant up` on the generated Vagrantfile")
-	(*cmd).Flags().BoolVar(&opts.NoPlan, "noplan", false, "If present, foregoes generating a plan file in this directory referencing the newly created nodes")
+	(*cmd).Flags().BoolVar(&opts.NoPlan, "noplan", false, "If present, foregoes generating a plan file in the cluster's directory referencing the newly created nodes")
 	(*cmd).Flags().BoolVarP(&opts.Storage, "storage-cluster", "s", false, "Create a storage cluster from all Worker nodes.")
 }
 
 func VagrantCreateCmd() *cobra.Command {
 	var etcdCount, masterCount, workerCount, ingressCount uint16
+	var etcdMemory, masterMemory, workerMemory, ingressMemory uint16
+	var etcdCPU, masterCPU, workerCPU, ingressCPU uint16
 
 	opts := VagrantCmdOpts{
 		PlanOpts: PlanOpts{
 			InfrastructureOpts: InfrastructureOpts{
-				Count: map[NodeType]uint16{},
+				Count:  map[NodeType]uint16{},
+				Memory: map[NodeType]uint16{},
+				CPU:    map[NodeType]uint16{},
 			},
 		},
 	}
@@ -72,11 +93,27 @@ func VagrantCreateCmd() *cobra.Command {
 
 Smallish instances will be created with public IP addresses. Unless option onlyGenerateVagrantfile is true, the command will not return 
 until the instances are all online and accessible via SSH.`,
+		Example: `# Create 1 etcd node, 1 master node and 1 worker node
+provision vagrant create
+
+# Create a compact cluster of 3 VMs, each of them running etcd, master and worker
+provision vagrant create -e 3 -m 3 -w 3 --overlapRoles
+
+# Create 3 etcd nodes, 2 master nodes, 3 worker nodes and 1 dedicated ingress node
+provision vagrant create -e 3 -m 2 -w 3 -i 1`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.Count[Etcd] = etcdCount
 			opts.Count[Master] = masterCount
 			opts.Count[Worker] = workerCount
 			opts.Count[Ingress] = ingressCount
+			opts.Memory[Etcd] = etcdMemory
+			opts.Memory[Master] = masterMemory
+			opts.Memory[Worker] = workerMemory
+			opts.Memory[Ingress] = ingressMemory
+			opts.CPU[Etcd] = etcdCPU
+			opts.CPU[Master] = masterCPU
+			opts.CPU[Worker] = workerCPU
+			opts.CPU[Ingress] = ingressCPU
 			return makeInfrastructure(&opts)
 		},
 	}
@@ -84,8 +121,16 @@ until the instances are all online and accessible via SSH.`,
 	cmd.Flags().Uint16VarP(&etcdCount, "etcdNodeCount", "e", 1, "Count of etcd nodes to produce.")
 	cmd.Flags().Uint16VarP(&masterCount, "masterdNodeCount", "m", 1, "Count of master nodes to produce.")
 	cmd.Flags().Uint16VarP(&workerCount, "workerNodeCount", "w", 1, "Count of worker nodes to produce.")
-	// cmd.Flags().Uint16VarP(&ingressCount, "ingressNodeCount", "i", 1, "Count of ingress nodes to produce")
-	// cmd.Flags().BoolVar(&opts.OverlapRoles, "overlapRoles", false, "Overlap roles to create as few nodes as possible")
+	cmd.Flags().Uint16VarP(&ingressCount, "ingressNodeCount", "i", 0, "Count of dedicated ingress nodes to produce. If 0, the first worker node is used for ingress.")
+	cmd.Flags().BoolVar(&opts.OverlapRoles, "overlapRoles", false, "Overlap roles to create as few nodes as possible. The Nth node of every role is placed on the same VM.")
+	cmd.Flags().Uint16Var(&etcdMemory, "etcdMemory", 1024, "Memory in MB of each etcd node.")
+	cmd.Flags().Uint16Var(&masterMemory, "masterMemory", 2048, "Memory in MB of each master node.")
+	cmd.Flags().Uint16Var(&workerMemory, "workerMemory", 2048, "Memory in MB of each worker node.")
+	cmd.Flags().Uint16Var(&ingressMemory, "ingressMemory", 1024, "Memory in MB of each ingress node.")
+	cmd.Flags().Uint16Var(&etcdCPU, "etcdCPUs", 1, "Count of CPUs of each etcd node.")
+	cmd.Flags().Uint16Var(&masterCPU, "masterCPUs", 2, "Count of CPUs of each master node.")
+	cmd.Flags().Uint16Var(&workerCPU, "workerCPUs", 1, "Count of CPUs of each worker node.")
+	cmd.Flags().Uint16Var(&ingressCPU, "ingressCPUs", 1, "Count of CPUs of each ingress node.")
 
 	AddSharedFlags(cmd, &opts)
 
@@ -93,6 +138,8 @@ until the instances are all online and accessible via SSH.`,
 }
 
 func VagrantCreateMinikubeCmd() *cobra.Command {
+	var memory, cpu uint16
+
 	opts := VagrantCmdOpts{
 		PlanOpts: PlanOpts{
 			InfrastructureOpts: InfrastructureOpts{
@@ -102,6 +149,8 @@ func VagrantCreateMinikubeCmd() *cobra.Command {
 					Worker:  1,
 					Ingress: 1,
 				},
+				Memory:       map[NodeType]uint16{},
+				CPU:          map[NodeType]uint16{},
 				OverlapRoles: true,
 			},
 		},
@@ -114,39 +163,96 @@ func VagrantCreateMinikubeCmd() *cobra.Command {
 
 A smallish instance will be created with public IP addresses. The command will not return until the instance is online and accessible via SSH.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, nodeType := range NodeTypes {
+				opts.Memory[nodeType] = memory
+				opts.CPU[nodeType] = cpu
+			}
 			return makeInfrastructure(&opts)
 		},
 	}
 
+	cmd.Flags().Uint16Var(&memory, "memory", 2048, "Memory in MB of the node.")
+	cmd.Flags().Uint16Var(&cpu, "cpus", 2, "Count of CPUs of the node.")
+
 	AddSharedFlags(cmd, &opts)
 
 	return cmd
 }
 
 func makeInfrastructure(opts *VagrantCmdOpts) error {
+	switch opts.Provider {
+	case "", "virtualbox", "vmware_fusion", "libvirt":
+	default:
+		return fmt.Errorf("unsupported vagrant provider %q. One of virtualbox|vmware_fusion|libvirt", opts.Provider)
+	}
+	if err := selectOS(&opts.InfrastructureOpts); err != nil {
+		return err
+	}
+	if err := selectBox(&opts.InfrastructureOpts); err != nil {
+		return err
+	}
+
+	dir, err := clusterDir(opts.ClusterName)
+	if err != nil {
+		return err
+	}
+	opts.Vagrantfile = filepath.Join(dir, "Vagrantfile")
+	if _, err := os.Stat(opts.Vagrantfile); err == nil {
+		return fmt.Errorf("cluster %q already exists in %v. Destroy it with 'provision vagrant destroy %v', or choose another name", opts.ClusterName, dir, opts.ClusterName)
+	}
+
 	infrastructure, infraErr := NewInfrastructure(&opts.InfrastructureOpts)
 	if infraErr != nil {
 		return infraErr
 	}
 
+	// Run the preflight before writing anything, so that a failure leaves no cluster behind.
+	// The cluster directory does not exist yet, and boxes are not specific to a directory.
+	if !opts.OnlyGenerateVagrantfile {
+		if boxErr := checkBoxInstalled(Client{}, &opts.InfrastructureOpts); boxErr != nil {
+			if opts.Offline {
+				return boxErr
+			}
+			fmt.Printf("Box %s is not installed yet, vagrant will download it\n", opts.Box)
+		}
+	}
+
 	_, vagrantErr := createVagrantfile(opts, infrastructure)
 	if vagrantErr != nil {
 		return vagrantErr
 	}
 
+	client := Client{Dir: dir}
 	if opts.OnlyGenerateVagrantfile {
 		fmt.Println("To create your local VMs, run:")
-		fmt.Println("vagrant up")
-	} else {
-		if vagrantUpErr := vagrantUp(); vagrantUpErr != nil {
-			return vagrantUpErr
+		fmt.Println("cd " + dir)
+		if opts.Provider != "" {
+			fmt.Println("vagrant up --provider " + opts.Provider)
+		} else {
+			fmt.Println("vagrant up")
 		}
+		return nil
 	}
 
-	infrastructure.PrivateSSHKeyPath = grabSSHConfig()
+	if vagrantUpErr := client.Up(opts.Provider); vagrantUpErr != nil {
+		return vagrantUpErr
+	}
+
+	sshConfigs, sshErr := client.SSHConfig()
+	if sshErr != nil {
+		return sshErr
+	}
+	if sshErr = infrastructure.applySSHConfig(sshConfigs); sshErr != nil {
+		return sshErr
+	}
+	fmt.Println("Waiting for VMs to be accessible via SSH")
+	if sshErr = waitForSSH(sshConfigs, 5*time.Minute); sshErr != nil {
+		return sshErr
+	}
+	fmt.Println()
 
 	if !opts.NoPlan {
-		planFile, planErr := createPlan(opts, infrastructure)
+		planFile, planErr := createPlan(dir, opts, infrastructure)
 		if planErr != nil {
 			return planErr
 		}
@@ -159,7 +265,11 @@ func makeInfrastructure(opts *VagrantCmdOpts) error {
 }
 
 func createVagrantfile(opts *VagrantCmdOpts, infrastructure *Infrastructure) (string, error) {
-	vagrantfile, err := utils.MakeFileAskOnOverwrite("Vagrantfile")
+	if err := os.MkdirAll(filepath.Dir(opts.Vagrantfile), 0755); err != nil {
+		return "", err
+	}
+
+	vagrantfile, err := os.Create(opts.Vagrantfile)
 	if err != nil {
 		return "", err
 	}
@@ -169,6 +279,7 @@ func createVagrantfile(opts *VagrantCmdOpts, infrastructure *Infrastructure) (st
 	vagrant := &Vagrant{
 		Opts:           &opts.InfrastructureOpts,
 		Infrastructure: infrastructure,
+		ClusterName:    opts.ClusterName,
 	}
 
 	err = vagrant.Write(vagrantfile)
@@ -179,8 +290,9 @@ func createVagrantfile(opts *VagrantCmdOpts, infrastructure *Infrastructure) (st
 	return vagrantfile.Name(), nil
 }
 
-func createPlan(opts *VagrantCmdOpts, infrastructure *Infrastructure) (string, error) {
-	planFile, err := utils.MakeUniqueFile("kismatic-cluster", ".yaml", 0)
+// createPlan writes the plan file into the directory of the cluster, next to its Vagrantfile
+func createPlan(dir string, opts *VagrantCmdOpts, infrastructure *Infrastructure) (string, error) {
+	planFile, err := os.Create(filepath.Join(dir, "kismatic-cluster.yaml"))
 	if err != nil {
 		return "", err
 	}
@@ -199,3 +311,28 @@ func createPlan(opts *VagrantCmdOpts, infrastructure *Infrastructure) (string, e
 
 	return planFile.Name(), nil
 }
+
+func generateAlphaNumericPassword() string {
+	attempts := 0
+	for {
+		reqs := &garbler.PasswordStrengthRequirements{
+			MinimumTotalLength: 16,
+			Uppercase:          rand.Intn(6),
+			Digits:             rand.Intn(6),
+			Punctuation:        -1, // disable punctuation
+		}
+		pass, err := garbler.NewPassword(reqs)
+		if err != nil {
+			return "weakpassword"
+		}
+		// validate that the library actually returned an alphanumeric password
+		re := regexp.MustCompile("^[a-zA-Z1-9]+$")
+		if re.MatchString(pass) {
+			return pass
+		}
+		if attempts == 50 {
+			return "weakpassword"
+		}
+		attempts++
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/apprenda/kismatic-provision/provision/utils"
+	"github.com/sashajeltuhin/ket/provision/utils"
 )
 
 type NodeType uint32
@@ -30,8 +30,15 @@ var NodeTypeStrings = map[NodeType]string{
 
 type InfrastructureOpts struct {
 	Count             map[NodeType]uint16
+	Memory            map[NodeType]uint16
+	CPU               map[NodeType]uint16
 	OverlapRoles      bool
 	NodeCIDR          string
+	ManagementCIDR    string
+	Provider          string
+	OS                string
+	Box               string
+	BoxVersion        string
 	Redhat            bool
 	PrivateSSHKeyPath string
 	Vagrantfile       string
@@ -39,18 +46,27 @@ type InfrastructureOpts struct {
 }
 
 type NodeDetails struct {
-	Name  string
-	IP    net.IP
-	Types NodeType
+	Name   string
+	IP     net.IP
+	Types  NodeType
+	Memory uint16
+	CPU    uint16
+	SSH    SSHConfig
+	// SSHHost is the address the installer reaches the node on, with the SSH port of the infrastructure
+	SSHHost string
 }
 
 type Infrastructure struct {
-	Network           net.IPNet
+	Network net.IPNet
+	// ManagementNetwork is the DHCP network libvirt uses to reach the VMs, apart from the static node network
+	ManagementNetwork net.IPNet
 	Broadcast         net.IP
 	Nodes             []NodeDetails
 	DNSReflector      string
 	PrivateSSHKeyPath string
 	PublicSSHKeyPath  string
+	SSHUser           string
+	SSHPort           int
 }
 
 func NewInfrastructure(opts *InfrastructureOpts) (*Infrastructure, error) {
@@ -71,6 +87,21 @@ func NewInfrastructure(opts *InfrastructureOpts) (*Infrastructure, error) {
 		Nodes:     []NodeDetails{},
 	}
 
+	if err := i.ensureCapacity(nodeCount(opts)); err != nil {
+		return nil, err
+	}
+
+	if opts.Provider == "libvirt" {
+		_, management, err := net.ParseCIDR(opts.ManagementCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid management network %q: %v", opts.ManagementCIDR, err)
+		}
+		if management.Contains(network.IP) || network.Contains(management.IP) {
+			return nil, fmt.Errorf("the management network %v overlaps the node network %v", management, network)
+		}
+		i.ManagementNetwork = *management
+	}
+
 	// sshError := i.ensureSSHKeys(opts.PrivateSSHKeyPath)
 	// if sshError != nil {
 	// 	return nil, sshError
@@ -88,7 +119,7 @@ func NewInfrastructure(opts *InfrastructureOpts) (*Infrastructure, error) {
 				if opts.OverlapRoles {
 					overlapTypes |= nodeType
 				} else {
-					_, err := i.appendNode(j, NodeTypeStrings[nodeType], nodeType)
+					_, err := i.appendNode(j, NodeTypeStrings[nodeType], nodeType, opts.Memory[nodeType], opts.CPU[nodeType])
 					if err != nil {
 						return i, err
 					}
@@ -98,7 +129,8 @@ func NewInfrastructure(opts *InfrastructureOpts) (*Infrastructure, error) {
 		}
 
 		if overlapTypes > 0 {
-			_, err := i.appendNode(j, "node", overlapTypes)
+			memory, cpu := overlapResources(opts, overlapTypes)
+			_, err := i.appendNode(j, "node", overlapTypes, memory, cpu)
 			if err != nil {
 				return i, err
 			}
@@ -146,7 +178,106 @@ func (i *Infrastructure) ensureSSHKeys(privateSSHKeyPath string) error {
 	return nil
 }
 
-func (i *Infrastructure) appendNode(nodeIndex uint16, name string, types NodeType) (*NodeDetails, error) {
+// nodeCount returns the number of machines that will be created for the given options
+func nodeCount(opts *InfrastructureOpts) int {
+	count := 0
+	for _, nodeType := range NodeTypes {
+		if opts.OverlapRoles {
+			if int(opts.Count[nodeType]) > count {
+				count = int(opts.Count[nodeType])
+			}
+		} else {
+			count += int(opts.Count[nodeType])
+		}
+	}
+	return count
+}
+
+// overlapResources returns the memory and CPU of a machine that has all the given roles,
+// which is the largest setting among the roles.
+func overlapResources(opts *InfrastructureOpts, types NodeType) (uint16, uint16) {
+	var memory, cpu uint16
+	for _, nodeType := range NodeTypes {
+		if types&nodeType == 0 {
+			continue
+		}
+		if opts.Memory[nodeType] > memory {
+			memory = opts.Memory[nodeType]
+		}
+		if opts.CPU[nodeType] > cpu {
+			cpu = opts.CPU[nodeType]
+		}
+	}
+	return memory, cpu
+}
+
+// ensureCapacity returns an error if the network does not have enough host addresses
+// for the given number of nodes, after accounting for the gateway and broadcast addresses.
+func (i *Infrastructure) ensureCapacity(count int) error {
+	// skip the network and gateway addresses
+	ip, err := utils.IncrementIPv4(i.Network.IP)
+	if err != nil {
+		return err
+	}
+	for j := 0; j < count; j++ {
+		ip, err = utils.IncrementIPv4(ip)
+		if err != nil {
+			return err
+		}
+		if !i.Network.Contains(ip) || i.Broadcast.Equal(ip) {
+			return fmt.Errorf("infrastructure: node cidr %v only has room for %d nodes, but %d are required", i.Network.String(), j, count)
+		}
+	}
+	return nil
+}
+
+// applySSHConfig sets the SSH configuration of every node from the configuration reported by vagrant.
+// The plan only supports a single SSH user, key and port, so all nodes must share the user and key.
+// Nodes are reached on the host and port reported by vagrant when they all share the port. Otherwise,
+// as with the forwarded ports on the loopback interface of virtualbox, they are reached on their private IP.
+func (i *Infrastructure) applySSHConfig(configs map[string]SSHConfig) error {
+	direct := true
+	for j := range i.Nodes {
+		node := &i.Nodes[j]
+		config, ok := configs[node.Name]
+		if !ok {
+			return fmt.Errorf("infrastructure: no ssh config found for node %v", node.Name)
+		}
+		if j == 0 {
+			i.SSHUser = config.User
+			i.PrivateSSHKeyPath = config.IdentityFile
+			i.SSHPort = config.Port
+		} else if config.User != i.SSHUser || config.IdentityFile != i.PrivateSSHKeyPath {
+			return fmt.Errorf("infrastructure: node %v uses ssh user %q and key %q, but other nodes use %q and %q", node.Name, config.User, config.IdentityFile, i.SSHUser, i.PrivateSSHKeyPath)
+		}
+		if config.Port != i.SSHPort || isLoopback(config.HostName) {
+			direct = false
+		}
+		node.SSH = config
+	}
+	if !direct {
+		i.SSHPort = 22
+	}
+	for j := range i.Nodes {
+		node := &i.Nodes[j]
+		node.SSHHost = node.IP.String()
+		if direct {
+			node.SSHHost = node.SSH.HostName
+		}
+	}
+	return nil
+}
+
+// isLoopback returns true if the host is localhost or a loopback address
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (i *Infrastructure) appendNode(nodeIndex uint16, name string, types NodeType, memory, cpu uint16) (*NodeDetails, error) {
 	ip, err := i.nextNodeIP()
 
 	if err != nil {
@@ -156,9 +287,11 @@ func (i *Infrastructure) appendNode(nodeIndex uint16, name string, types NodeTyp
 	hostname := fmt.Sprintf("%v%03d", name, nodeIndex)
 
 	node := NodeDetails{
-		Name:  hostname,
-		IP:    ip,
-		Types: types,
+		Name:   hostname,
+		IP:     ip,
+		Types:  types,
+		Memory: memory,
+		CPU:    cpu,
 	}
 
 	i.Nodes = append(i.Nodes, node)
@@ -0,0 +1,132 @@
+package vagrant
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sashajeltuhin/ket/provision/utils"
+	"github.com/spf13/cobra"
+)
+
+const defaultClusterName = "kismatic"
+
+func VagrantStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status [CLUSTER]",
+		Short: "Shows the state of the VMs of a cluster, or of all clusters if none is given.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("at most one cluster name can be provided")
+			}
+			clusters := args
+			if len(clusters) == 0 {
+				var err error
+				if clusters, err = listClusters(); err != nil {
+					return err
+				}
+			}
+			return printStatus(clusters)
+		},
+	}
+
+	return cmd
+}
+
+func VagrantHaltCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "halt [CLUSTER]",
+		Short: "Shuts down the VMs of a cluster. The VMs can be started again with resume.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := clusterClient(args)
+			if err != nil {
+				return err
+			}
+			return client.Halt()
+		},
+	}
+
+	return cmd
+}
+
+func VagrantResumeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resume [CLUSTER]",
+		Short: "Starts the VMs of a cluster that was halted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := clusterClient(args)
+			if err != nil {
+				return err
+			}
+			return client.Resume()
+		},
+	}
+
+	return cmd
+}
+
+func VagrantDestroyCmd() *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "destroy [CLUSTER]",
+		Short: "Destroys the VMs of a cluster and removes its Vagrantfile. This will destroy the cluster. Be ready.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := clusterClient(args)
+			if err != nil {
+				return err
+			}
+			if !yes && !utils.AskForConfirmation(fmt.Sprintf("Destroy all the VMs in %v?", client.Dir)) {
+				return errors.New("destroy aborted")
+			}
+			if err := client.Destroy(); err != nil {
+				return err
+			}
+			return os.RemoveAll(client.Dir)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation before destroying the cluster.")
+
+	return cmd
+}
+
+// clusterClient returns a client for the cluster named in the arguments,
+// or for the default cluster if no name is given.
+func clusterClient(args []string) (*Client, error) {
+	if len(args) > 1 {
+		return nil, errors.New("at most one cluster name can be provided")
+	}
+	name := defaultClusterName
+	if len(args) == 1 {
+		name = args[0]
+	}
+	dir, err := clusterDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("cluster %q does not exist in %v", name, dir)
+	}
+	return &Client{Dir: dir}, nil
+}
+
+func printStatus(clusters []string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 10, 4, 3, ' ', 0)
+	fmt.Fprint(tw, "CLUSTER\tMACHINE\tSTATE\tPROVIDER\n")
+	for _, name := range clusters {
+		dir, err := clusterDir(name)
+		if err != nil {
+			return err
+		}
+		client := Client{Dir: dir}
+		machines, err := client.Status()
+		if err != nil {
+			return fmt.Errorf("error getting status of cluster %q: %v", name, err)
+		}
+		for _, m := range machines {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, m.Name, m.State, m.Provider)
+		}
+	}
+	return tw.Flush()
+}
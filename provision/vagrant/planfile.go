@@ -3,6 +3,7 @@ package vagrant
 import (
 	"bufio"
 	"html/template"
+	"io"
 	"os"
 )
 
@@ -24,20 +25,21 @@ type Plan struct {
 }
 
 func (p *Plan) Write(file *os.File) error {
-	template, err := template.New("planVagrantOverlay").Parse(planVagrantOverlay)
-	if err != nil {
-		return err
-	}
-
 	w := bufio.NewWriter(file)
 
-	if err = template.Execute(w, &p); err != nil {
+	if err := p.write(w); err != nil {
 		return err
 	}
 
-	w.Flush()
+	return w.Flush()
+}
 
-	return nil
+func (p *Plan) write(w io.Writer) error {
+	template, err := template.New("planVagrantOverlay").Parse(planVagrantOverlay)
+	if err != nil {
+		return err
+	}
+	return template.Execute(w, &p)
 }
 
 func (p *Plan) Etcd() []NodeDetails {
@@ -52,8 +54,18 @@ func (p *Plan) Worker() []NodeDetails {
 	return p.Infrastructure.nodesByType(Worker)
 }
 
+// Ingress returns the nodes that were created with the ingress role.
+// If there are none, the first worker is used as the ingress node.
 func (p *Plan) Ingress() []NodeDetails {
-	return p.Infrastructure.nodesByType(Worker)[0:1]
+	ingress := p.Infrastructure.nodesByType(Ingress)
+	if len(ingress) > 0 {
+		return ingress
+	}
+	workers := p.Infrastructure.nodesByType(Worker)
+	if len(workers) > 0 {
+		return workers[0:1]
+	}
+	return []NodeDetails{}
 }
 
 func (p *Plan) Storage() []NodeDetails {
@@ -76,9 +88,9 @@ const planVagrantOverlay = `cluster:
   certificates:
     expiry: 17520h                       # Self-signed certificate expiration period in hours; default is 2 years.
   ssh:
-    user: vagrant
+    user: {{.Infrastructure.SSHUser}}
     ssh_key: {{.Infrastructure.PrivateSSHKeyPath}}             # Absolute path to the ssh public key we should use to manage nodes.
-    ssh_port: 22
+    ssh_port: {{.Infrastructure.SSHPort}}
 docker_registry:                         # Here you will provide the details of your Docker registry or setup an internal one to run in the cluster. This is optional and the cluster will always have access to the Docker Hub.
   setup_internal: {{.Opts.AutoConfiguredDockerRegistry}}                  # When true, a Docker Registry will be installed on top of your cluster and used to host Docker images needed for its installation.
   address: {{.Opts.DockerRegistryHost}}                            # IP or hostname for your Docker registry. An internal registry will NOT be setup when this field is provided. Must be accessible from all the nodes in the cluster.
@@ -88,27 +100,32 @@ etcd:
   expected_count: {{len .Etcd}}
   nodes:{{range .Etcd}}
   - host: {{.Name}}
-    ip: {{.IP.String}}{{end}}
+    ip: {{.SSHHost}}
+    internalip: {{.IP.String}}{{end}}
 master:
   expected_count: {{len .Master}}
   nodes:{{range .Master}}
   - host: {{.Name}}
-    ip: {{.IP.String}}{{end}}
+    ip: {{.SSHHost}}
+    internalip: {{.IP.String}}{{end}}
   load_balanced_fqdn: {{with index .Master 0 }}{{.IP.String}}{{end}}
   load_balanced_short_name: {{with index .Master 0}}{{.IP.String}}{{end}}
 worker:
   expected_count: {{len .Worker}}
   nodes:{{range .Worker}}
   - host: {{.Name}}
-    ip: {{.IP.String}}{{end}}
+    ip: {{.SSHHost}}
+    internalip: {{.IP.String}}{{end}}
 ingress:
   expected_count: {{len .Ingress}}
   nodes:{{range .Ingress}}
   - host: {{.Name}}
-    ip: {{.IP.String}}{{end}}
+    ip: {{.SSHHost}}
+    internalip: {{.IP.String}}{{end}}
 storage:
   expected_count: {{len .Storage}}
   nodes:{{range .Storage}}
   - host: {{.Name}}
-    ip: {{.IP.String}}{{end}}
+    ip: {{.SSHHost}}
+    internalip: {{.IP.String}}{{end}}
 `
@@ -0,0 +1,82 @@
+package vagrant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func nodeNames(nodes []NodeDetails) []string {
+	names := []string{}
+	for _, n := range nodes {
+		names = append(names, n.Name)
+	}
+	return names
+}
+
+func TestPlanRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		ingressCount uint16
+		overlapRoles bool
+		machines     []string
+		workers      []string
+		ingress      []string
+	}{
+		{
+			name:     "no ingress nodes",
+			machines: []string{"etcd001", "master001", "worker001", "worker002"},
+			workers:  []string{"worker001", "worker002"},
+			ingress:  []string{"worker001"},
+		},
+		{
+			name:         "dedicated ingress nodes",
+			ingressCount: 2,
+			machines:     []string{"etcd001", "master001", "worker001", "ingress001", "worker002", "ingress002"},
+			workers:      []string{"worker001", "worker002"},
+			ingress:      []string{"ingress001", "ingress002"},
+		},
+		{
+			name:         "overlapping roles without ingress nodes",
+			overlapRoles: true,
+			machines:     []string{"node001", "node002"},
+			workers:      []string{"node001", "node002"},
+			ingress:      []string{"node001"},
+		},
+		{
+			name:         "overlapping roles with ingress nodes",
+			ingressCount: 2,
+			overlapRoles: true,
+			machines:     []string{"node001", "node002"},
+			workers:      []string{"node001", "node002"},
+			ingress:      []string{"node001", "node002"},
+		},
+	}
+	for _, test := range tests {
+		opts := &PlanOpts{
+			InfrastructureOpts: InfrastructureOpts{
+				Count:        map[NodeType]uint16{Etcd: 1, Master: 1, Worker: 2, Ingress: test.ingressCount},
+				Memory:       map[NodeType]uint16{},
+				CPU:          map[NodeType]uint16{},
+				OverlapRoles: test.overlapRoles,
+				NodeCIDR:     "192.168.42.0/24",
+			},
+		}
+		infrastructure, err := NewInfrastructure(&opts.InfrastructureOpts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		plan := &Plan{Opts: opts, Infrastructure: infrastructure}
+		if got := nodeNames(infrastructure.Nodes); !reflect.DeepEqual(got, test.machines) {
+			t.Errorf("%s: expected machines %v, got %v", test.name, test.machines, got)
+		}
+		if got := nodeNames(plan.Worker()); !reflect.DeepEqual(got, test.workers) {
+			t.Errorf("%s: expected workers %v, got %v", test.name, test.workers, got)
+		}
+		if got := nodeNames(plan.Ingress()); !reflect.DeepEqual(got, test.ingress) {
+			t.Errorf("%s: expected ingress nodes %v, got %v", test.name, test.ingress, got)
+		}
+		if len(plan.Etcd()) != 1 || len(plan.Master()) != 1 {
+			t.Errorf("%s: expected 1 etcd and 1 master node, got %v and %v", test.name, nodeNames(plan.Etcd()), nodeNames(plan.Master()))
+		}
+	}
+}
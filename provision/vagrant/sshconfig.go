@@ -0,0 +1,137 @@
+package vagrant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSHConfig is how a vagrant machine can be reached via SSH, as reported by `vagrant ssh-config`
+type SSHConfig struct {
+	HostName     string
+	Port         int
+	User         string
+	IdentityFile string
+}
+
+// SSHConfig returns the SSH configuration of every machine defined in the Vagrantfile, keyed by machine name
+func (c Client) SSHConfig() (map[string]SSHConfig, error) {
+	cmd := c.command("ssh-config")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error getting vagrant ssh-config: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseSSHConfig(bytes.NewReader(out))
+}
+
+// parseSSHConfig parses the ssh_config formatted output of `vagrant ssh-config`.
+// Only the first value of each option is kept, as ssh itself does.
+func parseSSHConfig(r io.Reader) (map[string]SSHConfig, error) {
+	configs := map[string]SSHConfig{}
+	seen := map[string]bool{}
+	host := ""
+	var current SSHConfig
+	flush := func() {
+		if host != "" {
+			configs[host] = current
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value := splitSSHConfigLine(line)
+		if value == "" {
+			return nil, fmt.Errorf("ssh-config line %d: missing value for %q", lineNum, key)
+		}
+		key = strings.ToLower(key)
+		if key == "host" {
+			flush()
+			host = value
+			current = SSHConfig{Port: 22}
+			seen = map[string]bool{}
+			continue
+		}
+		if host == "" {
+			return nil, fmt.Errorf("ssh-config line %d: %q found before any Host", lineNum, key)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch key {
+		case "hostname":
+			current.HostName = value
+		case "user":
+			current.User = value
+		case "identityfile":
+			current.IdentityFile = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("ssh-config line %d: invalid port %q", lineNum, value)
+			}
+			current.Port = port
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return configs, nil
+}
+
+// splitSSHConfigLine splits a line into its key and value. The value may be quoted,
+// and the key may be separated from the value by whitespace or an equals sign.
+func splitSSHConfigLine(line string) (string, string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return line, ""
+	}
+	key := line[:i]
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
+
+// sshAccessible returns true if the machine accepts SSH connections with the given configuration
+func sshAccessible(config SSHConfig) bool {
+	cmd := exec.Command("ssh")
+	cmd.Args = append(cmd.Args, "-i", config.IdentityFile)
+	cmd.Args = append(cmd.Args, "-p", strconv.Itoa(config.Port))
+	cmd.Args = append(cmd.Args, "-o", "ConnectTimeout=5")
+	cmd.Args = append(cmd.Args, "-o", "BatchMode=yes")
+	cmd.Args = append(cmd.Args, "-o", "StrictHostKeyChecking=no")
+	cmd.Args = append(cmd.Args, "-o", "UserKnownHostsFile=/dev/null")
+	cmd.Args = append(cmd.Args, fmt.Sprintf("%s@%s", config.User, config.HostName), "exit") // just call exit if we are able to connect
+	return cmd.Run() == nil
+}
+
+// waitForSSH blocks until all the machines are accessible via SSH, or the timeout expires
+func waitForSSH(configs map[string]SSHConfig, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for name, config := range configs {
+		for !sshAccessible(config) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for %s to be accessible via SSH", name)
+			}
+			fmt.Print(".")
+			time.Sleep(3 * time.Second)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package vagrant
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+const sampleSSHConfig = `Host etcd001
+  HostName 127.0.0.1
+  User vagrant
+  Port 2222
+  UserKnownHostsFile /dev/null
+  StrictHostKeyChecking no
+  PasswordAuthentication no
+  IdentityFile "/Users/kismatic/.vagrant.d/insecure private key"
+  IdentityFile /Users/kismatic/.vagrant.d/other_key
+  IdentitiesOnly yes
+  LogLevel FATAL
+
+Host master001
+  HostName 192.168.121.45
+  User root
+  IdentityFile=/tmp/master.pem
+`
+
+func TestParseSSHConfig(t *testing.T) {
+	configs, err := parseSSHConfig(strings.NewReader(sampleSSHConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]SSHConfig{
+		"etcd001": {
+			HostName:     "127.0.0.1",
+			Port:         2222,
+			User:         "vagrant",
+			IdentityFile: "/Users/kismatic/.vagrant.d/insecure private key",
+		},
+		"master001": {
+			HostName:     "192.168.121.45",
+			Port:         22,
+			User:         "root",
+			IdentityFile: "/tmp/master.pem",
+		},
+	}
+	if len(configs) != len(expected) {
+		t.Fatalf("expected %d hosts, but got %d: %+v", len(expected), len(configs), configs)
+	}
+	for host, exp := range expected {
+		if configs[host] != exp {
+			t.Errorf("host %s: expected %+v, but got %+v", host, exp, configs[host])
+		}
+	}
+}
+
+func TestParseSSHConfigErrors(t *testing.T) {
+	tests := []string{
+		"HostName 127.0.0.1\n",
+		"Host etcd001\n  Port abc\n",
+		"Host etcd001\n  User\n",
+	}
+	for _, test := range tests {
+		if _, err := parseSSHConfig(strings.NewReader(test)); err == nil {
+			t.Errorf("expected an error parsing %q, but got none", test)
+		}
+	}
+}
+
+func testInfrastructure() *Infrastructure {
+	return &Infrastructure{
+		Nodes: []NodeDetails{
+			{Name: "etcd001", IP: net.ParseIP("192.168.42.2"), Types: Etcd},
+			{Name: "master001", IP: net.ParseIP("192.168.42.3"), Types: Master | Worker},
+		},
+	}
+}
+
+func TestApplySSHConfigDirect(t *testing.T) {
+	i := testInfrastructure()
+	err := i.applySSHConfig(map[string]SSHConfig{
+		"etcd001":   {HostName: "192.168.121.10", Port: 22, User: "vagrant", IdentityFile: "/tmp/key"},
+		"master001": {HostName: "192.168.121.11", Port: 22, User: "vagrant", IdentityFile: "/tmp/key"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if i.SSHUser != "vagrant" || i.PrivateSSHKeyPath != "/tmp/key" || i.SSHPort != 22 {
+		t.Errorf("unexpected ssh settings: user %q, key %q, port %d", i.SSHUser, i.PrivateSSHKeyPath, i.SSHPort)
+	}
+	if i.Nodes[0].SSHHost != "192.168.121.10" || i.Nodes[1].SSHHost != "192.168.121.11" {
+		t.Errorf("expected the nodes to be reached on the hosts reported by vagrant, got %q and %q", i.Nodes[0].SSHHost, i.Nodes[1].SSHHost)
+	}
+
+	var plan bytes.Buffer
+	p := &Plan{Opts: &PlanOpts{}, Infrastructure: i}
+	if err := p.write(&plan); err != nil {
+		t.Fatalf("unexpected error writing plan: %v", err)
+	}
+	for _, s := range []string{"user: vagrant", "ssh_key: /tmp/key", "ssh_port: 22", "ip: 192.168.121.11\n    internalip: 192.168.42.3"} {
+		if !strings.Contains(plan.String(), s) {
+			t.Errorf("expected the plan to contain %q:\n%s", s, plan.String())
+		}
+	}
+}
+
+func TestApplySSHConfigForwardedPorts(t *testing.T) {
+	i := testInfrastructure()
+	err := i.applySSHConfig(map[string]SSHConfig{
+		"etcd001":   {HostName: "127.0.0.1", Port: 2222, User: "vagrant", IdentityFile: "/tmp/key"},
+		"master001": {HostName: "127.0.0.1", Port: 2200, User: "vagrant", IdentityFile: "/tmp/key"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if i.SSHPort != 22 {
+		t.Errorf("expected port 22, got %d", i.SSHPort)
+	}
+	if i.Nodes[0].SSHHost != "192.168.42.2" || i.Nodes[1].SSHHost != "192.168.42.3" {
+		t.Errorf("expected the nodes to be reached on their private IPs, got %q and %q", i.Nodes[0].SSHHost, i.Nodes[1].SSHHost)
+	}
+}
+
+func TestApplySSHConfigErrors(t *testing.T) {
+	tests := []map[string]SSHConfig{
+		{"etcd001": {HostName: "192.168.121.10", Port: 22, User: "vagrant", IdentityFile: "/tmp/key"}},
+		{
+			"etcd001":   {HostName: "192.168.121.10", Port: 22, User: "vagrant", IdentityFile: "/tmp/key"},
+			"master001": {HostName: "192.168.121.11", Port: 22, User: "root", IdentityFile: "/tmp/key"},
+		},
+	}
+	for _, configs := range tests {
+		if err := testInfrastructure().applySSHConfig(configs); err == nil {
+			t.Errorf("expected an error applying %+v", configs)
+		}
+	}
+}
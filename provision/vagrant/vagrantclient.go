@@ -2,15 +2,21 @@ package vagrant
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 const vagrantCmd string = "vagrant"
 
+// clustersDir is the directory, relative to the working directory, where each cluster's Vagrantfile is kept
+const clustersDir = "vagrant-clusters"
+
 func ensureVagrantOnPath() string {
 	path, err := exec.LookPath(vagrantCmd)
 	if err != nil {
@@ -19,56 +25,145 @@ func ensureVagrantOnPath() string {
 	return path
 }
 
-func grabSSHConfig() string {
-	cmd := exec.Command("vagrant", "ssh-config")
-	bytes, err := cmd.CombinedOutput()
+// clusterNameRegexp matches the cluster names that are accepted: DNS labels, which cannot escape clustersDir
+var clusterNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
 
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error getting ssh config for newly created vagrant image", err)
-		os.Exit(1)
+// clusterDir returns the directory that holds the Vagrantfile and the plan file of the given cluster.
+// It fails if the name is not valid, so that no command ever runs outside of clustersDir.
+func clusterDir(name string) (string, error) {
+	if !clusterNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid cluster name %q. Use lowercase letters, digits and '-', starting and ending with a letter or digit", name)
 	}
+	dir := filepath.Join(clustersDir, name)
+	if rel, err := filepath.Rel(clustersDir, dir); err != nil || rel != name {
+		return "", fmt.Errorf("cluster %q is outside of %v", name, clustersDir)
+	}
+	return dir, nil
+}
 
-	r, err := regexp.Compile(`.*IdentityFile\ (.*)`)
+// listClusters returns the names of the clusters that have a Vagrantfile
+func listClusters() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(clustersDir, "*", "Vagrantfile"))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error compiling regex", err)
-		os.Exit(1)
+		return nil, err
 	}
+	names := []string{}
+	for _, m := range matches {
+		names = append(names, filepath.Base(filepath.Dir(m)))
+	}
+	return names, nil
+}
 
-	a := r.FindSubmatch(bytes)
+// MachineStatus is the state of a vagrant machine as reported by `vagrant status`
+type MachineStatus struct {
+	Name     string
+	State    string
+	Provider string
+}
 
-	return string(a[1])
+// Client runs vagrant commands against the Vagrantfile in Dir
+type Client struct {
+	Dir string
 }
 
-func vagrantUp() error {
-	cmdPath := ensureVagrantOnPath()
+func (c Client) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(ensureVagrantOnPath(), args...)
+	cmd.Dir = c.Dir
+	return cmd
+}
 
-	cmdArgs := []string{"up"}
-	cmd := exec.Command(cmdPath, cmdArgs...)
+// run executes vagrant with the given arguments, streaming its output to stdout and stderr
+func (c Client) run(args ...string) error {
+	cmd := c.command(args...)
 
 	cmdReader, err := cmd.StdoutPipe()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating StdoutPipe for Cmd", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating StdoutPipe for vagrant: %v", err)
 	}
+	cmd.Stderr = os.Stderr
 
 	scanner := bufio.NewScanner(cmdReader)
+	done := make(chan struct{})
 	go func() {
 		for scanner.Scan() {
 			fmt.Printf("%s\n", scanner.Text())
 		}
+		close(done)
 	}()
 
-	fmt.Printf("executing '%v up'\n", vagrantCmd)
-	err = cmd.Start()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
-		os.Exit(1)
+	fmt.Printf("executing '%v %v' in %v\n", vagrantCmd, strings.Join(args, " "), c.Dir)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting vagrant: %v", err)
 	}
+	<-done
+
+	return cmd.Wait()
+}
 
-	cmdErr := cmd.Wait()
-	if cmdErr != nil {
-		return cmdErr
+// Up creates and starts the machines. If provider is empty, vagrant chooses the default provider.
+func (c Client) Up(provider string) error {
+	args := []string{"up"}
+	if provider != "" {
+		args = append(args, "--provider", provider)
 	}
+	return c.run(args...)
+}
+
+// Halt shuts down the running machines
+func (c Client) Halt() error {
+	return c.run("halt")
+}
 
-	return nil
+// Resume starts the machines that were halted, without running the provisioners again
+func (c Client) Resume() error {
+	return c.run("up", "--no-provision")
+}
+
+// Destroy stops and deletes all the machines
+func (c Client) Destroy() error {
+	return c.run("destroy", "--force")
+}
+
+// Status returns the state of every machine defined in the Vagrantfile
+func (c Client) Status() ([]MachineStatus, error) {
+	cmd := c.command("status", "--machine-readable")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error getting vagrant status: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseMachineReadableStatus(out), nil
+}
+
+// parseMachineReadableStatus parses the output of `vagrant status --machine-readable`.
+// Each line has the format timestamp,target,type,data...
+func parseMachineReadableStatus(out []byte) []MachineStatus {
+	machines := []MachineStatus{}
+	index := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 4 || fields[1] == "" {
+			continue
+		}
+		target, dataType := fields[1], fields[2]
+		data := strings.Replace(strings.Join(fields[3:], ","), "%!(VAGRANT_COMMA)", ",", -1)
+		if dataType != "state" && dataType != "provider-name" {
+			continue
+		}
+		i, ok := index[target]
+		if !ok {
+			i = len(machines)
+			index[target] = i
+			machines = append(machines, MachineStatus{Name: target})
+		}
+		switch dataType {
+		case "state":
+			machines[i].State = data
+		case "provider-name":
+			machines[i].Provider = data
+		}
+	}
+	return machines
 }
@@ -0,0 +1,78 @@
+package vagrant
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMachineReadableStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		expected []MachineStatus
+	}{
+		{
+			name:     "no output",
+			out:      "",
+			expected: []MachineStatus{},
+		},
+		{
+			name: "machines in order",
+			out: `1496255432,etcd001,metadata,provider,virtualbox
+1496255432,etcd001,provider-name,virtualbox
+1496255432,etcd001,state,running
+1496255432,etcd001,state-human-short,running
+1496255432,master001,provider-name,virtualbox
+1496255432,master001,state,poweroff
+1496255432,,ui,info,Current machine states:
+`,
+			expected: []MachineStatus{
+				{Name: "etcd001", State: "running", Provider: "virtualbox"},
+				{Name: "master001", State: "poweroff", Provider: "virtualbox"},
+			},
+		},
+		{
+			name: "escaped commas and missing provider",
+			out: `1496255432,node001,state,not_created
+1496255432,node002,provider-name,libvirt
+1496255432,node002,state,shut%!(VAGRANT_COMMA)off
+`,
+			expected: []MachineStatus{
+				{Name: "node001", State: "not_created"},
+				{Name: "node002", State: "shut,off", Provider: "libvirt"},
+			},
+		},
+		{
+			name:     "malformed lines",
+			out:      "garbage\n1496255432,node001\n1496255432,node001,state\n",
+			expected: []MachineStatus{},
+		},
+	}
+	for _, test := range tests {
+		machines := parseMachineReadableStatus([]byte(test.out))
+		if !reflect.DeepEqual(machines, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, machines)
+		}
+	}
+}
+
+func TestClusterDir(t *testing.T) {
+	valid := []string{"kismatic", "k8s-dev", "a", "0"}
+	for _, name := range valid {
+		dir, err := clusterDir(name)
+		if err != nil {
+			t.Errorf("unexpected error for cluster %q: %v", name, err)
+			continue
+		}
+		if dir != filepath.Join(clustersDir, name) {
+			t.Errorf("unexpected directory %q for cluster %q", dir, name)
+		}
+	}
+	invalid := []string{"", ".", "..", "../kismatic", "a/b", "/tmp", "-dev", "dev-", "Kismatic", "dev_1"}
+	for _, name := range invalid {
+		if _, err := clusterDir(name); err == nil {
+			t.Errorf("expected an error for cluster %q", name)
+		}
+	}
+}
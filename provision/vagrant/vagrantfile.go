@@ -4,15 +4,29 @@ import (
 	"bufio"
 	"html/template"
 	"os"
+	"strings"
 )
 
 type Vagrant struct {
 	Opts           *InfrastructureOpts
 	Infrastructure *Infrastructure
+	ClusterName    string
 	UnescapedLTLT  template.HTML
 	UnescapedGTGT  template.HTML
 }
 
+// NetworkName returns the name of the libvirt network of the nodes, which belongs to the cluster
+func (v *Vagrant) NetworkName() string {
+	return "kismatic-" + v.ClusterName
+}
+
+// ManagementNetworkName returns the name of the libvirt management network. It is named after its
+// address rather than the cluster: libvirt cannot create two networks with the same address, and the
+// DHCP management network can be shared by the clusters that use the same management CIDR.
+func (v *Vagrant) ManagementNetworkName() string {
+	return "kismatic-mgmt-" + strings.NewReplacer(".", "-", "/", "-", ":", "-").Replace(v.Infrastructure.ManagementNetwork.String())
+}
+
 func (v *Vagrant) Write(file *os.File) error {
 
 	v.UnescapedGTGT = template.HTML(">>")
@@ -25,7 +39,7 @@ func (v *Vagrant) Write(file *os.File) error {
 
 	w := bufio.NewWriter(file)
 
-	if err = template.Execute(w, &v); err != nil {
+	if err = template.Execute(w, v); err != nil {
 		return err
 	}
 
@@ -38,14 +52,15 @@ const vagrantfileOverlay = `boxes = [
     {{range $index,$element := .Infrastructure.Nodes}}{{if $index}},{{end}}{
         :name => "{{.Name}}",
         :eth1 => "{{.IP.String}}",
-        :mem => "1024",
-        :cpu => "1"
+        :mem => "{{.Memory}}",
+        :cpu => "{{.CPU}}"
     }{{end}}
 ]
 
 Vagrant.configure(2) do |config|
 
-  config.vm.box = "{{if .Opts.Redhat}}bento/centos-7.3{{else}}bento/ubuntu-16.04{{end}}"
+  config.vm.box = "{{.Opts.Box}}"{{if .Opts.BoxVersion}}
+  config.vm.box_version = "{{.Opts.BoxVersion}}"{{end}}
   config.ssh.insert_key = false
 
   # Turn off shared folders
@@ -66,9 +81,18 @@ Vagrant.configure(2) do |config|
         # needed to get around a vagrant stack bug with Ubuntu, safe for Centos
         v.customize ["modifyvm", :id, "--cableconnected1", "on"]
       end
+{{if eq .Opts.Provider "libvirt"}}
+      config.vm.provider "libvirt" do |v|
+        v.memory = opts[:mem].to_i
+        v.cpus = opts[:cpu].to_i
+        v.management_network_name = "{{.ManagementNetworkName}}"
+        v.management_network_address = "{{.Infrastructure.ManagementNetwork.String}}"
+      end
 
+      config.vm.network :private_network, ip: opts[:eth1], libvirt__network_name: "{{.NetworkName}}", libvirt__dhcp_enabled: false
+{{else}}
       config.vm.network :private_network, ip: opts[:eth1]
-
+{{end}}
       {{if .Opts.Redhat}}# needed to get around a vagrant stack bug with Centos 7x, safe for ubuntu
       # https://github.com/mitchellh/vagrant/issues/5590
 
@@ -0,0 +1,52 @@
+package vagrant
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func renderVagrantfile(t *testing.T, clusterName string, nodeCIDR string) string {
+	opts := &InfrastructureOpts{
+		Count:          map[NodeType]uint16{Etcd: 1, Master: 1, Worker: 1},
+		Memory:         map[NodeType]uint16{Etcd: 1024, Master: 1024, Worker: 1024},
+		CPU:            map[NodeType]uint16{Etcd: 1, Master: 1, Worker: 1},
+		NodeCIDR:       nodeCIDR,
+		ManagementCIDR: "192.168.121.0/24",
+		Provider:       "libvirt",
+		Box:            "generic/ubuntu1604",
+	}
+	infrastructure, err := NewInfrastructure(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := ioutil.TempFile("", "Vagrantfile")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	v := &Vagrant{Opts: opts, Infrastructure: infrastructure, ClusterName: clusterName}
+	if err := v.Write(f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(data)
+}
+
+func TestVagrantfileLibvirtNetworks(t *testing.T) {
+	a := renderVagrantfile(t, "alpha", "192.168.42.0/24")
+	b := renderVagrantfile(t, "beta", "192.168.43.0/24")
+	if !strings.Contains(a, `libvirt__network_name: "kismatic-alpha"`) || !strings.Contains(b, `libvirt__network_name: "kismatic-beta"`) {
+		t.Errorf("expected the node network to be named after the cluster:\n%s\n%s", a, b)
+	}
+	// Clusters with the same management CIDR share the management network
+	mgmt := `v.management_network_name = "kismatic-mgmt-192-168-121-0-24"`
+	if !strings.Contains(a, mgmt) || !strings.Contains(b, mgmt) {
+		t.Errorf("expected the management network to be named after its address:\n%s\n%s", a, b)
+	}
+}